@@ -0,0 +1,55 @@
+package bot_detector
+
+import "strings"
+
+// DefaultRules 识别爬虫的User-Agent片段，不区分大小写，包含任意一个片段即视为爬虫。
+// 通用的bot只匹配后面紧跟/、;、-或)的情况，避免误判CUBOT等手机型号，
+// 其后跟空格或位于末尾的爬虫（如Slackbot 1.0、Googlebot）需要单独列出；
+// 链接预览使用抓取程序自身的User-Agent，不能匹配App内置浏览器（如Pinterest、Flipboard、Tumblr）
+var DefaultRules = []string{
+	// 通用
+	"bot/", "bot;", "bot-", "bot)", "crawler", "spider", "crawl", "slurp", "headless",
+
+	// 链接预览
+	"slackbot", "slack-imgproxy", "telegrambot", "twitterbot", "facebookexternalhit", "facebookcatalog", "embedly", "quora link preview", "outbrain",
+	"pinterestbot", "vkshare", "w3c_validator", "whatsapp", "skypeuripreview", "nuzzel",
+	"bitlybot", "flipboardproxy", "flipboardrss", "redditbot", "iframely", "mastodon",
+
+	// 搜索引擎
+	"googlebot", "bingpreview", "yandex", "baiduspider", "360spider", "bytespider", "petalbot",
+	"duckduckbot", "ia_archiver", "archive.org_bot",
+
+	// 监控与脚本
+	"pingdom", "uptimerobot", "statuscake", "site24x7", "lighthouse", "python-requests",
+	"python-urllib", "go-http-client", "java/", "okhttp", "curl/", "wget/", "libwww-perl", "apache-httpclient",
+}
+
+// BotDetector 按User-Agent规则识别爬虫，空的User-Agent不视为爬虫
+type BotDetector struct {
+	rules []string
+}
+
+// New rules为额外的规则，与DefaultRules一起生效
+func New(rules ...string) *BotDetector {
+	detector := &BotDetector{
+		rules: make([]string, 0, len(DefaultRules)+len(rules)),
+	}
+	for _, ruleSet := range [][]string{DefaultRules, rules} {
+		for _, rule := range ruleSet {
+			if rule != "" {
+				detector.rules = append(detector.rules, strings.ToLower(rule))
+			}
+		}
+	}
+	return detector
+}
+
+func (detector *BotDetector) IsBot(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, rule := range detector.rules {
+		if strings.Contains(userAgent, rule) {
+			return true
+		}
+	}
+	return false
+}
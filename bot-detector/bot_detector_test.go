@@ -0,0 +1,49 @@
+package bot_detector
+
+import "testing"
+
+func TestBotDetector(t *testing.T) {
+	detector := New("MyMonitor")
+
+	testCases := []struct {
+		userAgent string
+		expected  bool
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148", false},
+		// 手机型号与App内置浏览器
+		{"Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", false},
+		{"Mozilla/5.0 (Linux; Android 12; CUBOT_NOTE_20_PRO) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [Pinterest/iOS]", false},
+		{"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36 [Pinterest/Android]", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Flipboard/4.3.5", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Tumblr/iPhone/33.3", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1 Ddg/17.0", false},
+		{"", false},
+		// 命令行工具与HTTP库一致视为爬虫
+		{"curl/7.64.0", true},
+		{"Wget/1.21.3", true},
+		{"Mozilla/5.0 (compatible; Pinterestbot/1.0; +http://www.pinterest.com/bot.html)", true},
+		{"FlipboardProxy/1.2; +http://flipboard.com/browserproxy", true},
+		{"DuckDuckBot-Https/1.1; (+https://duckduckgo.com/duckduckbot)", true},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Slackbot 1.0 (+https://api.slack.com/robots)", true},
+		{"Slack-ImgProxy (+https://api.slack.com/robots)", true},
+		{"TelegramBot (like TwitterBot)", true},
+		{"Googlebot", true},
+		{"Twitterbot/1.0", true},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)", true},
+		{"WhatsApp/2.23.20.0", true},
+		{"Mozilla/5.0 (compatible; MyMonitor/1.0)", true},
+	}
+	for _, testCase := range testCases {
+		if isBot := detector.IsBot(testCase.userAgent); isBot != testCase.expected {
+			t.Errorf("BotDetector_IsBot ERROR, %s expected %t, got %t", testCase.userAgent, testCase.expected, isBot)
+			return
+		}
+	}
+
+	t.Logf("BotDetector PASS")
+}
@@ -0,0 +1,121 @@
+package click_event
+
+import (
+	"errors"
+	"github.com/zhuyst/shorturl-service/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBufferFull AsyncSink的缓冲区已满，事件被丢弃
+var ErrBufferFull = errors.New("click event buffer full")
+
+// ErrClosed AsyncSink已关闭，事件被丢弃
+var ErrClosed = errors.New("click event sink closed")
+
+// Event 一次跳转的点击事件
+type Event struct {
+	Key            string    `json:"key"`
+	Time           time.Time `json:"time"`
+	Referrer       string    `json:"referrer,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	ClientIp       string    `json:"client_ip,omitempty"`
+	AcceptLanguage string    `json:"accept_language,omitempty"`
+
+	// 根据User-Agent识别为爬虫
+	Bot bool `json:"bot"`
+}
+
+// Sink 点击事件的写入目标，实现该接口即可把事件写入Kafka、日志文件等
+type Sink interface {
+	Write(event *Event) error
+}
+
+// SinkFunc 把普通函数适配为Sink
+type SinkFunc func(event *Event) error
+
+func (f SinkFunc) Write(event *Event) error {
+	return f(event)
+}
+
+// MultiSink 依次写入多个Sink，单个Sink失败不影响其他Sink，返回第一个错误
+type MultiSink []Sink
+
+func (sinks MultiSink) Write(event *Event) error {
+	var firstErr error
+	for _, sink := range sinks {
+		if err := sink.Write(event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// AsyncSink 在后台依次写入事件，Write不会阻塞，缓冲区已满时丢弃事件并返回ErrBufferFull
+type AsyncSink struct {
+	sink    Sink
+	events  chan *Event
+	dropped int64
+
+	// 保护events的关闭，Write持读锁，Close持写锁
+	mutex  sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewAsyncSink(sink Sink, buffer int) *AsyncSink {
+	asyncSink := &AsyncSink{
+		sink:   sink,
+		events: make(chan *Event, buffer),
+		done:   make(chan struct{}),
+	}
+	go asyncSink.start()
+
+	return asyncSink
+}
+
+func (asyncSink *AsyncSink) Write(event *Event) error {
+	asyncSink.mutex.RLock()
+	defer asyncSink.mutex.RUnlock()
+
+	if asyncSink.closed {
+		return ErrClosed
+	}
+
+	select {
+	case asyncSink.events <- event:
+		return nil
+	default:
+		atomic.AddInt64(&asyncSink.dropped, 1)
+		return ErrBufferFull
+	}
+}
+
+// Dropped 因缓冲区已满而丢弃的事件数量
+func (asyncSink *AsyncSink) Dropped() int64 {
+	return atomic.LoadInt64(&asyncSink.dropped)
+}
+
+// Close 停止接收事件，等待缓冲区中的事件全部写入后返回，可以重复调用
+func (asyncSink *AsyncSink) Close() error {
+	asyncSink.mutex.Lock()
+	if !asyncSink.closed {
+		asyncSink.closed = true
+		close(asyncSink.events)
+	}
+	asyncSink.mutex.Unlock()
+
+	<-asyncSink.done
+	return nil
+}
+
+func (asyncSink *AsyncSink) start() {
+	defer close(asyncSink.done)
+
+	for event := range asyncSink.events {
+		if err := asyncSink.sink.Write(event); err != nil {
+			logger.Error("ClickEvent Write FAIL, key: %s, Error: %s", event.Key, err.Error())
+		}
+	}
+}
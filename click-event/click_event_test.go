@@ -0,0 +1,90 @@
+package click_event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncSink(t *testing.T) {
+	events := make(chan *Event)
+	asyncSink := NewAsyncSink(SinkFunc(func(event *Event) error {
+		events <- event
+		return nil
+	}), 1)
+
+	if err := asyncSink.Write(&Event{Key: "4dUaeq5"}); err != nil {
+		t.Errorf("AsyncSink_Write ERROR: %s", err.Error())
+		return
+	}
+
+	select {
+	case event := <-events:
+		if event.Key != "4dUaeq5" {
+			t.Errorf("AsyncSink_Write ERROR, expected 4dUaeq5, got %s", event.Key)
+			return
+		}
+	case <-time.After(time.Second):
+		t.Errorf("AsyncSink_Write ERROR, event not written after 1s")
+		return
+	}
+
+	t.Logf("AsyncSink PASS")
+}
+
+func TestAsyncSink_BufferFull(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	asyncSink := NewAsyncSink(SinkFunc(func(event *Event) error {
+		<-block
+		return nil
+	}), 1)
+
+	// 第一条事件阻塞在sink中，第二条占满缓冲区，之后的事件被丢弃
+	var dropped int64
+	for i := 0; i < 5; i++ {
+		if err := asyncSink.Write(&Event{Key: "4dUaeq5"}); err == ErrBufferFull {
+			dropped++
+		}
+	}
+	if dropped < 3 || asyncSink.Dropped() != dropped {
+		t.Errorf("AsyncSink_BufferFull ERROR, expected at least 3 dropped, got %d %d", dropped, asyncSink.Dropped())
+		return
+	}
+
+	t.Logf("AsyncSink_BufferFull PASS")
+}
+
+func TestAsyncSink_Close(t *testing.T) {
+	var written int64
+	asyncSink := NewAsyncSink(SinkFunc(func(event *Event) error {
+		time.Sleep(time.Millisecond)
+		written++
+		return nil
+	}), 10)
+
+	for i := 0; i < 5; i++ {
+		if err := asyncSink.Write(&Event{Key: "4dUaeq5"}); err != nil {
+			t.Errorf("AsyncSink_Write ERROR: %s", err.Error())
+			return
+		}
+	}
+
+	// Close等待缓冲区中的事件全部写入
+	for i := 0; i < 2; i++ {
+		if err := asyncSink.Close(); err != nil {
+			t.Errorf("AsyncSink_Close ERROR: %s", err.Error())
+			return
+		}
+	}
+	if written != 5 {
+		t.Errorf("AsyncSink_Close ERROR, expected 5 written, got %d", written)
+		return
+	}
+
+	if err := asyncSink.Write(&Event{Key: "4dUaeq5"}); err != ErrClosed {
+		t.Errorf("AsyncSink_Close ERROR, expected ErrClosed, got %v", err)
+		return
+	}
+
+	t.Logf("AsyncSink_Close PASS")
+}
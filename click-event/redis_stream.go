@@ -0,0 +1,130 @@
+package click_event
+
+import (
+	"github.com/go-redis/redis"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	streamKey = "SHORTURL_SERVICE:CLICK_EVENTS"
+
+	fieldKey            = "key"
+	fieldTime           = "time"
+	fieldReferrer       = "referrer"
+	fieldUserAgent      = "user_agent"
+	fieldClientIp       = "client_ip"
+	fieldAcceptLanguage = "accept_language"
+	fieldBot            = "bot"
+)
+
+// Message 通过消费者组读取的事件，处理完成后需要Ack，否则会留在消费者的待处理列表中
+type Message struct {
+	Id    string
+	Event *Event
+}
+
+// RedisStream 把点击事件写入Redis Stream，长度超过maxLen后裁剪最旧的事件。
+// 下游任务通过消费者组读取，同一组内的消费者分摊事件，不同的组各自读取全部事件
+type RedisStream struct {
+	redisClient redis.UniversalClient
+	maxLen      int64
+}
+
+// NewRedisStream maxLen为Stream保留的大致长度，裁剪使用MAXLEN ~，实际长度可能略多
+func NewRedisStream(redisClient redis.UniversalClient, maxLen int64) *RedisStream {
+	return &RedisStream{
+		redisClient: redisClient,
+		maxLen:      maxLen,
+	}
+}
+
+func (stream *RedisStream) Write(event *Event) error {
+	return stream.redisClient.XAdd(&redis.XAddArgs{
+		Stream:       streamKey,
+		MaxLenApprox: stream.maxLen,
+		Values: map[string]interface{}{
+			fieldKey:            event.Key,
+			fieldTime:           event.Time.Format(time.RFC3339Nano),
+			fieldReferrer:       event.Referrer,
+			fieldUserAgent:      event.UserAgent,
+			fieldClientIp:       event.ClientIp,
+			fieldAcceptLanguage: event.AcceptLanguage,
+			fieldBot:            strconv.FormatBool(event.Bot),
+		},
+	}).Err()
+}
+
+// CreateGroup 创建消费者组，start为"$"时只读取之后写入的事件，为"0"时从头读取，组已存在时不报错
+func (stream *RedisStream) CreateGroup(group string, start string) error {
+	err := stream.redisClient.XGroupCreateMkStream(streamKey, group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// ReadGroup 以consumer的身份读取组内尚未分配的事件，最多count条。
+// block大于0时最多等待block，为0时一直等待，小于0时不等待
+func (stream *RedisStream) ReadGroup(group string, consumer string, count int64,
+	block time.Duration) ([]*Message, error) {
+
+	return stream.read(group, consumer, ">", count, block)
+}
+
+// ReadPending 读取已分配给consumer但尚未Ack的事件，用于消费者重启后重新处理
+func (stream *RedisStream) ReadPending(group string, consumer string, count int64) ([]*Message, error) {
+	return stream.read(group, consumer, "0", count, -1)
+}
+
+func (stream *RedisStream) Ack(group string, ids ...string) error {
+	return stream.redisClient.XAck(streamKey, group, ids...).Err()
+}
+
+func (stream *RedisStream) read(group string, consumer string, id string, count int64,
+	block time.Duration) ([]*Message, error) {
+
+	streams, err := stream.redisClient.XReadGroup(&redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{streamKey, id},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*Message
+	for _, s := range streams {
+		for _, message := range s.Messages {
+			messages = append(messages, &Message{
+				Id:    message.ID,
+				Event: parseEvent(message.Values),
+			})
+		}
+	}
+	return messages, nil
+}
+
+func parseEvent(values map[string]interface{}) *Event {
+	field := func(name string) string {
+		value, _ := values[name].(string)
+		return value
+	}
+
+	t, _ := time.Parse(time.RFC3339Nano, field(fieldTime))
+	return &Event{
+		Key:            field(fieldKey),
+		Time:           t,
+		Referrer:       field(fieldReferrer),
+		UserAgent:      field(fieldUserAgent),
+		ClientIp:       field(fieldClientIp),
+		AcceptLanguage: field(fieldAcceptLanguage),
+		Bot:            field(fieldBot) == "true",
+	}
+}
@@ -0,0 +1,82 @@
+package click_event
+
+import (
+	"github.com/go-redis/redis"
+	"os"
+	"testing"
+	"time"
+)
+
+// miniredis不支持Stream，需要真实的Redis 5以上，例如 docker run -d -p 6379:6379 redis:5-alpine
+// SHORTURL_SERVICE_TEST_REDIS=localhost:6379
+const testRedisEnv = "SHORTURL_SERVICE_TEST_REDIS"
+
+func TestRedisStream(t *testing.T) {
+	addr := os.Getenv(testRedisEnv)
+	if addr == "" {
+		t.Skipf("%s not set, skip", testRedisEnv)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{Addr: addr})
+	redisClient.Del(streamKey)
+	defer redisClient.Del(streamKey)
+
+	stream := NewRedisStream(redisClient, 1000)
+	const group = "test"
+	if err := stream.CreateGroup(group, "0"); err != nil {
+		t.Errorf("RedisStream_CreateGroup ERROR: %s", err.Error())
+		return
+	}
+	if err := stream.CreateGroup(group, "0"); err != nil {
+		t.Errorf("RedisStream_CreateGroup ERROR, expected nil for existing group, got %s", err.Error())
+		return
+	}
+
+	event := &Event{
+		Key:            "4dUaeq5",
+		Time:           time.Now(),
+		Referrer:       "https://github.com/zhuyst",
+		UserAgent:      "curl/7.64.0",
+		ClientIp:       "127.0.0.1",
+		AcceptLanguage: "zh-CN",
+	}
+	if err := stream.Write(event); err != nil {
+		t.Errorf("RedisStream_Write ERROR: %s", err.Error())
+		return
+	}
+
+	messages, err := stream.ReadGroup(group, "consumer-1", 10, -1)
+	if err != nil {
+		t.Errorf("RedisStream_ReadGroup ERROR: %s", err.Error())
+		return
+	}
+	if len(messages) != 1 {
+		t.Errorf("RedisStream_ReadGroup ERROR, expected 1 message, got %d", len(messages))
+		return
+	}
+	got := messages[0].Event
+	if got.Key != event.Key || !got.Time.Equal(event.Time) || got.Referrer != event.Referrer ||
+		got.UserAgent != event.UserAgent || got.ClientIp != event.ClientIp ||
+		got.AcceptLanguage != event.AcceptLanguage {
+		t.Errorf("RedisStream_ReadGroup ERROR, expected %+v, got %+v", event, got)
+		return
+	}
+
+	// 未Ack的事件留在待处理列表中
+	pending, err := stream.ReadPending(group, "consumer-1", 10)
+	if err != nil || len(pending) != 1 || pending[0].Id != messages[0].Id {
+		t.Errorf("RedisStream_ReadPending ERROR, expected %s, got %+v %v", messages[0].Id, pending, err)
+		return
+	}
+
+	if err := stream.Ack(group, messages[0].Id); err != nil {
+		t.Errorf("RedisStream_Ack ERROR: %s", err.Error())
+		return
+	}
+	if pending, err := stream.ReadPending(group, "consumer-1", 10); err != nil || len(pending) != 0 {
+		t.Errorf("RedisStream_Ack ERROR, expected no pending, got %+v %v", pending, err)
+		return
+	}
+
+	t.Logf("RedisStream PASS")
+}
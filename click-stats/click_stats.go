@@ -0,0 +1,296 @@
+package click_stats
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/zhuyst/shorturl-service/click-event"
+	"github.com/zhuyst/shorturl-service/logger"
+	"sync"
+	"time"
+)
+
+// 统计粒度，区间按UTC划分
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// 各粒度的统计保留时长，超出后的区间被清理，查询返回0
+const (
+	HourlyRetention = 7 * 24 * time.Hour
+	DailyRetention  = 366 * 24 * time.Hour
+)
+
+const flushInterval = time.Second
+
+var (
+	ErrInvalidInterval = errors.New("interval need hour or day")
+	ErrInvalidRange    = errors.New("invalid time range")
+)
+
+// Bucket 一个区间的点击数，Time为区间的开始时间，Clicks不包括爬虫，爬虫的访问单独计入Bots，
+// 只有按天统计时有独立访客数
+type Bucket struct {
+	Time     time.Time `json:"time"`
+	Clicks   int64     `json:"clicks"`
+	Bots     int64     `json:"bots"`
+	Visitors int64     `json:"visitors,omitempty"`
+}
+
+// Storage 按小时与天保存每个key的点击数，以及每天的独立访客，实现需要自行清理超出保留时长的数据
+type Storage interface {
+	// Incr 把t所在小时与所在天的点击数都加1，bot为true时加到爬虫的访问数
+	Incr(key string, t time.Time, bot bool) error
+
+	// Series 返回[from, to)内每个区间的点击数，from与to已按interval对齐，没有点击的区间为0
+	Series(key string, interval string, from time.Time, to time.Time) ([]*Bucket, error)
+
+	// AddVisitor 把访客指纹计入t所在天的独立访客
+	AddVisitor(key string, t time.Time, visitor string) error
+
+	// Visitors 返回[from, to)内每天的独立访客数与整个范围去重后的访客数，from与to已按天对齐，
+	// 可以是HyperLogLog等方式的估计值
+	Visitors(key string, from time.Time, to time.Time) ([]int64, int64, error)
+}
+
+// BatchStorage 可选接口，一次写入多次点击或多个访客。存储未实现时逐个调用Incr与AddVisitor
+type BatchStorage interface {
+	// IncrBy 把t所在小时与所在天的点击数都加n
+	IncrBy(key string, t time.Time, bot bool, n int64) error
+
+	// AddVisitors 把多个访客指纹计入t所在天的独立访客
+	AddVisitors(key string, t time.Time, visitors []string) error
+}
+
+// ClickStats 把点击事件聚合为时间序列，作为click_event.Sink接收跳转产生的事件。
+// 点击数与访客先在内存中按小时与天累加，每秒批量写入存储，写入失败的保留到下一次写入
+type ClickStats struct {
+	storage Storage
+
+	mutex    sync.Mutex
+	clicks   map[clickBucket]int64
+	visitors map[visitorBucket]map[string]bool
+
+	flushTicker *time.Ticker
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// clickBucket 一个key在某小时内的点击数，hour为UTC的整点
+type clickBucket struct {
+	key  string
+	hour time.Time
+	bot  bool
+}
+
+// visitorBucket 一个key在某天内的访客，day为UTC的零点
+type visitorBucket struct {
+	key string
+	day time.Time
+}
+
+func New(storage Storage) *ClickStats {
+	stats := &ClickStats{
+		storage:  storage,
+		clicks:   make(map[clickBucket]int64),
+		visitors: make(map[visitorBucket]map[string]bool),
+		stop:     make(chan struct{}),
+	}
+	stats.start()
+
+	return stats
+}
+
+// Write 只在内存中累加，不访问存储，爬虫不计入独立访客
+func (stats *ClickStats) Write(event *click_event.Event) error {
+	t := event.Time.UTC()
+
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.clicks[clickBucket{event.Key, t.Truncate(time.Hour), event.Bot}]++
+	if !event.Bot {
+		stats.addVisitors(visitorBucket{event.Key, t.Truncate(24 * time.Hour)}, Fingerprint(event))
+	}
+	return nil
+}
+
+// addVisitors 调用方需持有mutex
+func (stats *ClickStats) addVisitors(bucket visitorBucket, visitors ...string) {
+	set := stats.visitors[bucket]
+	if set == nil {
+		set = make(map[string]bool)
+		stats.visitors[bucket] = set
+	}
+	for _, visitor := range visitors {
+		set[visitor] = true
+	}
+}
+
+// Flush 立即把累加的点击数与访客写入存储，返回遇到的第一个错误
+func (stats *ClickStats) Flush() error {
+	stats.mutex.Lock()
+	clicks, visitors := stats.clicks, stats.visitors
+	stats.clicks = make(map[clickBucket]int64)
+	stats.visitors = make(map[visitorBucket]map[string]bool)
+	stats.mutex.Unlock()
+
+	var firstErr error
+	for bucket, n := range clicks {
+		if err := stats.incr(bucket, n); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			stats.mutex.Lock()
+			stats.clicks[bucket] += n
+			stats.mutex.Unlock()
+		}
+	}
+
+	for bucket, set := range visitors {
+		list := make([]string, 0, len(set))
+		for visitor := range set {
+			list = append(list, visitor)
+		}
+
+		if err := stats.addVisitorsToStorage(bucket, list); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			stats.mutex.Lock()
+			stats.addVisitors(bucket, list...)
+			stats.mutex.Unlock()
+		}
+	}
+	return firstErr
+}
+
+func (stats *ClickStats) incr(bucket clickBucket, n int64) error {
+	if batch, ok := stats.storage.(BatchStorage); ok {
+		return batch.IncrBy(bucket.key, bucket.hour, bucket.bot, n)
+	}
+
+	for ; n > 0; n-- {
+		if err := stats.storage.Incr(bucket.key, bucket.hour, bucket.bot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (stats *ClickStats) addVisitorsToStorage(bucket visitorBucket, visitors []string) error {
+	if batch, ok := stats.storage.(BatchStorage); ok {
+		return batch.AddVisitors(bucket.key, bucket.day, visitors)
+	}
+
+	for _, visitor := range visitors {
+		if err := stats.storage.AddVisitor(bucket.key, bucket.day, visitor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (stats *ClickStats) start() {
+	ticker := time.NewTicker(flushInterval)
+	stats.flushTicker = ticker
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := stats.Flush(); err != nil {
+					logger.Error("ClickStats Flush FAIL, Error: %s", err.Error())
+				}
+			case <-stats.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止定期写入，并写入剩余的点击数与访客，可以重复调用
+func (stats *ClickStats) Close() error {
+	stats.stopOnce.Do(func() {
+		stats.flushTicker.Stop()
+		close(stats.stop)
+	})
+
+	return stats.Flush()
+}
+
+// Fingerprint 由客户端IP、User-Agent与Accept-Language计算的访客指纹，不保存原始信息
+func Fingerprint(event *click_event.Event) string {
+	sum := sha1.Sum([]byte(event.ClientIp + "\n" + event.UserAgent + "\n" + event.AcceptLanguage))
+	return hex.EncodeToString(sum[:])
+}
+
+// Series 查询[from, to)内按interval划分的点击数，from向前、to向后对齐到区间边界，
+// 范围不能超过该粒度的保留时长，查询前先写入累加的点击数
+func (stats *ClickStats) Series(key string, interval string, from time.Time, to time.Time) ([]*Bucket, error) {
+	from, to, err := alignRange(interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stats.Flush(); err != nil {
+		return nil, err
+	}
+
+	return stats.storage.Series(key, interval, from, to)
+}
+
+// Visitors 查询[from, to)所在各天的独立访客数与整个范围去重后的访客数，范围不能超过DailyRetention，
+// 查询前先写入累加的访客
+func (stats *ClickStats) Visitors(key string, from time.Time, to time.Time) ([]int64, int64, error) {
+	from, to, err := alignRange(IntervalDay, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := stats.Flush(); err != nil {
+		return nil, 0, err
+	}
+
+	return stats.storage.Visitors(key, from, to)
+}
+
+// alignRange from向前、to向后对齐到区间边界，并检查范围是否超过保留时长
+func alignRange(interval string, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	step, retention, err := intervalOf(interval)
+	if err != nil {
+		return from, to, err
+	}
+
+	from = from.UTC().Truncate(step)
+	to = to.UTC().Add(step - 1).Truncate(step)
+	if !from.Before(to) || to.Sub(from) > retention {
+		return from, to, ErrInvalidRange
+	}
+	return from, to, nil
+}
+
+// intervalOf 返回区间长度与保留时长
+func intervalOf(interval string) (time.Duration, time.Duration, error) {
+	switch interval {
+	case IntervalHour:
+		return time.Hour, HourlyRetention, nil
+	case IntervalDay:
+		return 24 * time.Hour, DailyRetention, nil
+	}
+	return 0, 0, ErrInvalidInterval
+}
+
+// bucketTimes 返回[from, to)内每个区间的开始时间
+func bucketTimes(interval string, from time.Time, to time.Time) []time.Time {
+	step, _, _ := intervalOf(interval)
+
+	var times []time.Time
+	for t := from; t.Before(to); t = t.Add(step) {
+		times = append(times, t)
+	}
+	return times
+}
@@ -0,0 +1,249 @@
+package click_stats
+
+import (
+	"github.com/zhuyst/shorturl-service/click-event"
+	"testing"
+	"time"
+)
+
+func testStorage(t *testing.T, storage Storage) {
+	base := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	for _, clickTime := range []time.Time{
+		base,
+		base.Add(10 * time.Minute),
+		base.Add(time.Hour),
+		base.Add(24 * time.Hour),
+		base.In(time.FixedZone("CST", 8*3600)),
+	} {
+		if err := storage.Incr("4dUaeq5", clickTime, false); err != nil {
+			t.Errorf("Storage_Incr ERROR: %s", err.Error())
+			return
+		}
+	}
+	storage.Incr("other", base, false)
+
+	// 爬虫的访问单独计数
+	for i := 0; i < 2; i++ {
+		if err := storage.Incr("4dUaeq5", base, true); err != nil {
+			t.Errorf("Storage_Incr ERROR: %s", err.Error())
+			return
+		}
+	}
+
+	testCases := []struct {
+		interval string
+		from     time.Time
+		to       time.Time
+		expected []int64
+	}{
+		{IntervalHour, base.Truncate(time.Hour).Add(-time.Hour), base.Truncate(time.Hour).Add(3 * time.Hour),
+			[]int64{0, 3, 1, 0}},
+		{IntervalDay, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC),
+			[]int64{0, 4, 1}},
+		// 跨月的Hash
+		{IntervalDay, time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+			append(make([]int64, 18), 4)},
+	}
+	for _, testCase := range testCases {
+		series, err := storage.Series("4dUaeq5", testCase.interval, testCase.from, testCase.to)
+		if err != nil {
+			t.Errorf("Storage_Series ERROR: %s", err.Error())
+			return
+		}
+		if len(series) != len(testCase.expected) {
+			t.Errorf("Storage_Series %s ERROR, expected %d buckets, got %d",
+				testCase.interval, len(testCase.expected), len(series))
+			return
+		}
+		for i, bucket := range series {
+			if bucket.Clicks != testCase.expected[i] {
+				t.Errorf("Storage_Series %s ERROR, expected %v at %d, got %d",
+					testCase.interval, testCase.expected, i, bucket.Clicks)
+				return
+			}
+
+			var bots int64
+			if bucket.Time.Equal(base.Truncate(time.Hour)) || bucket.Time.Equal(base.Truncate(24*time.Hour)) {
+				bots = 2
+			}
+			if bucket.Bots != bots {
+				t.Errorf("Storage_Series %s ERROR, expected %d bots at %s, got %d",
+					testCase.interval, bots, bucket.Time, bucket.Bots)
+				return
+			}
+		}
+	}
+
+	t.Logf("Storage PASS")
+}
+
+func TestClickStats(t *testing.T) {
+	stats := New(NewMemoryStorage())
+	now := time.Now()
+	if err := stats.Write(&click_event.Event{Key: "4dUaeq5", Time: now}); err != nil {
+		t.Errorf("ClickStats_Write ERROR: %s", err.Error())
+		return
+	}
+
+	// 范围两端对齐到区间边界
+	series, err := stats.Series("4dUaeq5", IntervalHour, now, now)
+	if err != nil {
+		t.Errorf("ClickStats_Series ERROR: %s", err.Error())
+		return
+	}
+	if len(series) != 1 || series[0].Clicks != 1 {
+		t.Errorf("ClickStats_Series ERROR, expected 1 bucket with 1 click, got %+v", series)
+		return
+	}
+
+	testCases := []struct {
+		interval string
+		from     time.Time
+		to       time.Time
+		expected error
+	}{
+		{"week", now.Add(-time.Hour), now, ErrInvalidInterval},
+		{IntervalHour, now, now.Add(-2 * time.Hour), ErrInvalidRange},
+		{IntervalHour, now.Add(-HourlyRetention - time.Hour), now, ErrInvalidRange},
+		{IntervalDay, now.Add(-DailyRetention - 24*time.Hour), now, ErrInvalidRange},
+	}
+	for _, testCase := range testCases {
+		if _, err := stats.Series("4dUaeq5", testCase.interval, testCase.from, testCase.to); err != testCase.expected {
+			t.Errorf("ClickStats_Series ERROR, expected %v, got %v", testCase.expected, err)
+			return
+		}
+	}
+
+	t.Logf("ClickStats PASS")
+}
+
+func testStorageVisitors(t *testing.T, storage Storage) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for _, visit := range []struct {
+		t       time.Time
+		visitor string
+	}{
+		{day.Add(time.Hour), "a"},
+		{day.Add(2 * time.Hour), "a"},
+		{day.Add(3 * time.Hour), "b"},
+		{day.Add(25 * time.Hour), "a"},
+		{day.Add(26 * time.Hour), "c"},
+	} {
+		if err := storage.AddVisitor("4dUaeq5", visit.t, visit.visitor); err != nil {
+			t.Errorf("Storage_AddVisitor ERROR: %s", err.Error())
+			return
+		}
+	}
+	storage.AddVisitor("other", day, "d")
+
+	daily, total, err := storage.Visitors("4dUaeq5", day.AddDate(0, 0, -1), day.AddDate(0, 0, 2))
+	if err != nil {
+		t.Errorf("Storage_Visitors ERROR: %s", err.Error())
+		return
+	}
+	if len(daily) != 3 || daily[0] != 0 || daily[1] != 2 || daily[2] != 2 || total != 3 {
+		t.Errorf("Storage_Visitors ERROR, expected [0 2 2] 3, got %v %d", daily, total)
+		return
+	}
+
+	t.Logf("Storage_Visitors PASS")
+}
+
+func TestClickStats_Visitors(t *testing.T) {
+	stats := New(NewMemoryStorage())
+	now := time.Now()
+	for _, event := range []*click_event.Event{
+		{Key: "4dUaeq5", Time: now, ClientIp: "127.0.0.1", UserAgent: "curl/7.64.0"},
+		{Key: "4dUaeq5", Time: now, ClientIp: "127.0.0.1", UserAgent: "curl/7.64.0"},
+		{Key: "4dUaeq5", Time: now, ClientIp: "127.0.0.1", UserAgent: "Mozilla/5.0"},
+		{Key: "4dUaeq5", Time: now, ClientIp: "127.0.0.1", UserAgent: "Slackbot", Bot: true},
+	} {
+		if err := stats.Write(event); err != nil {
+			t.Errorf("ClickStats_Write ERROR: %s", err.Error())
+			return
+		}
+	}
+
+	daily, total, err := stats.Visitors("4dUaeq5", now, now)
+	if err != nil {
+		t.Errorf("ClickStats_Visitors ERROR: %s", err.Error())
+		return
+	}
+	// 爬虫不计入独立访客
+	if len(daily) != 1 || daily[0] != 2 || total != 2 {
+		t.Errorf("ClickStats_Visitors ERROR, expected [2] 2, got %v %d", daily, total)
+		return
+	}
+
+	t.Logf("ClickStats_Visitors PASS")
+}
+
+// countingStorage 记录写入存储的次数
+type countingStorage struct {
+	*MemoryStorage
+	writes int
+}
+
+func (storage *countingStorage) IncrBy(key string, t time.Time, bot bool, n int64) error {
+	storage.writes++
+	return storage.MemoryStorage.IncrBy(key, t, bot, n)
+}
+
+func (storage *countingStorage) AddVisitors(key string, t time.Time, visitors []string) error {
+	storage.writes++
+	return storage.MemoryStorage.AddVisitors(key, t, visitors)
+}
+
+func TestClickStats_Flush(t *testing.T) {
+	storage := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	stats := New(storage)
+	now := time.Now()
+
+	// 同一小时的点击与同一天的访客各合并为一次写入
+	for i := 0; i < 100; i++ {
+		stats.Write(&click_event.Event{Key: "4dUaeq5", Time: now, ClientIp: "127.0.0.1"})
+	}
+	if err := stats.Close(); err != nil {
+		t.Errorf("ClickStats_Close ERROR: %s", err.Error())
+		return
+	}
+	if storage.writes != 2 {
+		t.Errorf("ClickStats_Flush ERROR, expected 2 writes, got %d", storage.writes)
+		return
+	}
+
+	series, err := stats.Series("4dUaeq5", IntervalHour, now, now)
+	if err != nil || len(series) != 1 || series[0].Clicks != 100 {
+		t.Errorf("ClickStats_Flush ERROR, expected 100 clicks, got %+v %v", series, err)
+		return
+	}
+
+	t.Logf("ClickStats_Flush PASS")
+}
+
+// minimalStorage 只实现Storage接口，不实现BatchStorage
+type minimalStorage struct {
+	Storage
+}
+
+func TestClickStats_FlushWithoutBatchStorage(t *testing.T) {
+	stats := New(minimalStorage{NewMemoryStorage()})
+	defer stats.Close()
+	now := time.Now()
+
+	for _, userAgent := range []string{"a", "a", "b"} {
+		stats.Write(&click_event.Event{Key: "4dUaeq5", Time: now, UserAgent: userAgent})
+	}
+
+	series, err := stats.Series("4dUaeq5", IntervalDay, now, now)
+	if err != nil || len(series) != 1 || series[0].Clicks != 3 {
+		t.Errorf("ClickStats_FlushWithoutBatchStorage ERROR, expected 3 clicks, got %+v %v", series, err)
+		return
+	}
+	if _, total, err := stats.Visitors("4dUaeq5", now, now); err != nil || total != 2 {
+		t.Errorf("ClickStats_FlushWithoutBatchStorage ERROR, expected 2 visitors, got %d %v", total, err)
+		return
+	}
+
+	t.Logf("ClickStats_FlushWithoutBatchStorage PASS")
+}
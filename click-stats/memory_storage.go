@@ -0,0 +1,132 @@
+package click_stats
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStorage 进程内存储，重启后数据丢失
+type MemoryStorage struct {
+	mutex sync.RWMutex
+
+	// 粒度 -> key -> 区间开始时间 -> 点击数
+	buckets map[string]map[string]map[time.Time]*Bucket
+
+	// key -> 天 -> 访客指纹，精确去重，访客较多时占用内存较大
+	visitors map[string]map[time.Time]map[string]bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		buckets: map[string]map[string]map[time.Time]*Bucket{
+			IntervalHour: make(map[string]map[time.Time]*Bucket),
+			IntervalDay:  make(map[string]map[time.Time]*Bucket),
+		},
+		visitors: make(map[string]map[time.Time]map[string]bool),
+	}
+}
+
+func (storage *MemoryStorage) Incr(key string, t time.Time, bot bool) error {
+	return storage.IncrBy(key, t, bot, 1)
+}
+
+func (storage *MemoryStorage) IncrBy(key string, t time.Time, bot bool, n int64) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	t = t.UTC()
+	for interval, keys := range storage.buckets {
+		step, retention, _ := intervalOf(interval)
+		start := t.Truncate(step)
+
+		buckets := keys[key]
+		if buckets == nil {
+			buckets = make(map[time.Time]*Bucket)
+			keys[key] = buckets
+		}
+
+		// 新的区间开始时清理该key超出保留时长的区间
+		bucket := buckets[start]
+		if bucket == nil {
+			for bucketTime := range buckets {
+				if start.Sub(bucketTime) > retention {
+					delete(buckets, bucketTime)
+				}
+			}
+
+			bucket = &Bucket{Time: start}
+			buckets[start] = bucket
+		}
+
+		if bot {
+			bucket.Bots += n
+		} else {
+			bucket.Clicks += n
+		}
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) Series(key string, interval string, from time.Time, to time.Time) ([]*Bucket, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	buckets := storage.buckets[interval][key]
+	times := bucketTimes(interval, from, to)
+	series := make([]*Bucket, len(times))
+	for i, t := range times {
+		series[i] = &Bucket{Time: t}
+		if bucket := buckets[t]; bucket != nil {
+			*series[i] = *bucket
+		}
+	}
+	return series, nil
+}
+
+func (storage *MemoryStorage) AddVisitor(key string, t time.Time, visitor string) error {
+	return storage.AddVisitors(key, t, []string{visitor})
+}
+
+func (storage *MemoryStorage) AddVisitors(key string, t time.Time, visitors []string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	day := t.UTC().Truncate(24 * time.Hour)
+	days := storage.visitors[key]
+	if days == nil {
+		days = make(map[time.Time]map[string]bool)
+		storage.visitors[key] = days
+	}
+
+	set := days[day]
+	if set == nil {
+		for d := range days {
+			if day.Sub(d) > DailyRetention {
+				delete(days, d)
+			}
+		}
+
+		set = make(map[string]bool)
+		days[day] = set
+	}
+	for _, visitor := range visitors {
+		set[visitor] = true
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) Visitors(key string, from time.Time, to time.Time) ([]int64, int64, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	days := storage.visitors[key]
+	total := make(map[string]bool)
+	var daily []int64
+	for _, day := range bucketTimes(IntervalDay, from, to) {
+		daily = append(daily, int64(len(days[day])))
+		for visitor := range days[day] {
+			total[visitor] = true
+		}
+	}
+	return daily, int64(len(total)), nil
+}
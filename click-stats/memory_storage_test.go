@@ -0,0 +1,32 @@
+package click_stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestMemoryStorage_Retention(t *testing.T) {
+	storage := NewMemoryStorage()
+	base := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	storage.Incr("4dUaeq5", base, false)
+	storage.Incr("4dUaeq5", base.Add(HourlyRetention+time.Hour), false)
+
+	if buckets := len(storage.buckets[IntervalHour]["4dUaeq5"]); buckets != 1 {
+		t.Errorf("MemoryStorage_Retention ERROR, expected 1 hourly bucket, got %d", buckets)
+		return
+	}
+	if buckets := len(storage.buckets[IntervalDay]["4dUaeq5"]); buckets != 2 {
+		t.Errorf("MemoryStorage_Retention ERROR, expected 2 daily buckets, got %d", buckets)
+		return
+	}
+
+	t.Logf("MemoryStorage_Retention PASS")
+}
+
+func TestMemoryStorage_Visitors(t *testing.T) {
+	testStorageVisitors(t, NewMemoryStorage())
+}
@@ -0,0 +1,145 @@
+package click_stats
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+// 每小时的点击数按天存放在一个Hash中，field为小时；每天的点击数按月存放，field为日期；
+// 爬虫的访问数存放在同一个Hash中，field加上botFieldPrefix；
+// 每天的独立访客存放在一个HyperLogLog中。
+// key使用{hash tag}，同一个链接的统计在集群中位于同一个slot，可以对多天的HyperLogLog一起PFCOUNT
+const (
+	statsKeyPrefix = "SHORTURL_SERVICE:CLICK_STATS:"
+	botFieldPrefix = "bot:"
+)
+
+// RedisStorage 通过Hash保存时间序列、HyperLogLog估计独立访客，在其中最后一个区间超出保留时长后过期
+type RedisStorage struct {
+	redisClient redis.UniversalClient
+}
+
+func NewRedisStorage(redisClient redis.UniversalClient) *RedisStorage {
+	return &RedisStorage{
+		redisClient: redisClient,
+	}
+}
+
+func (storage *RedisStorage) Incr(key string, t time.Time, bot bool) error {
+	return storage.IncrBy(key, t, bot, 1)
+}
+
+func (storage *RedisStorage) IncrBy(key string, t time.Time, bot bool, n int64) error {
+	t = t.UTC()
+	_, err := storage.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, interval := range []string{IntervalHour, IntervalDay} {
+			hashKey, field, expireAt := bucketField(key, interval, t)
+			if bot {
+				field = botFieldPrefix + field
+			}
+			pipe.HIncrBy(hashKey, field, n)
+			pipe.ExpireAt(hashKey, expireAt)
+		}
+		return nil
+	})
+	return err
+}
+
+func (storage *RedisStorage) Series(key string, interval string, from time.Time, to time.Time) ([]*Bucket, error) {
+	times := bucketTimes(interval, from, to)
+
+	hashes := make(map[string]*redis.StringStringMapCmd)
+	_, err := storage.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, t := range times {
+			hashKey, _, _ := bucketField(key, interval, t)
+			if _, ok := hashes[hashKey]; !ok {
+				hashes[hashKey] = pipe.HGetAll(hashKey)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]*Bucket, len(times))
+	for i, t := range times {
+		hashKey, field, _ := bucketField(key, interval, t)
+		hash := hashes[hashKey].Val()
+
+		bucket := &Bucket{Time: t}
+		fmt.Sscan(hash[field], &bucket.Clicks)
+		fmt.Sscan(hash[botFieldPrefix+field], &bucket.Bots)
+		series[i] = bucket
+	}
+	return series, nil
+}
+
+func (storage *RedisStorage) AddVisitor(key string, t time.Time, visitor string) error {
+	return storage.AddVisitors(key, t, []string{visitor})
+}
+
+func (storage *RedisStorage) AddVisitors(key string, t time.Time, visitors []string) error {
+	if len(visitors) == 0 {
+		return nil
+	}
+
+	elements := make([]interface{}, len(visitors))
+	for i, visitor := range visitors {
+		elements[i] = visitor
+	}
+
+	t = t.UTC()
+	hllKey := visitorsKey(key, t)
+	_, err := storage.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(hllKey, elements...)
+		pipe.ExpireAt(hllKey, t.Truncate(24*time.Hour).AddDate(0, 0, 1).Add(DailyRetention))
+		return nil
+	})
+	return err
+}
+
+func (storage *RedisStorage) Visitors(key string, from time.Time, to time.Time) ([]int64, int64, error) {
+	days := bucketTimes(IntervalDay, from, to)
+	keys := make([]string, len(days))
+	for i, day := range days {
+		keys[i] = visitorsKey(key, day)
+	}
+
+	counts := make([]*redis.IntCmd, len(keys))
+	var total *redis.IntCmd
+	_, err := storage.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, hllKey := range keys {
+			counts[i] = pipe.PFCount(hllKey)
+		}
+		total = pipe.PFCount(keys...)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	daily := make([]int64, len(counts))
+	for i, count := range counts {
+		daily[i] = count.Val()
+	}
+	return daily, total.Val(), nil
+}
+
+func visitorsKey(key string, day time.Time) string {
+	return fmt.Sprintf("%s{%s}:VISITORS:%s", statsKeyPrefix, key, day.Format("20060102"))
+}
+
+// bucketField 返回t所在区间对应的Hash、field与Hash的过期时间
+func bucketField(key string, interval string, t time.Time) (string, string, time.Time) {
+	if interval == IntervalHour {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return fmt.Sprintf("%s{%s}:HOUR:%s", statsKeyPrefix, key, day.Format("20060102")),
+			t.Format("15"), day.AddDate(0, 0, 1).Add(HourlyRetention)
+	}
+
+	month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("%s{%s}:DAY:%s", statsKeyPrefix, key, month.Format("200601")),
+		t.Format("02"), month.AddDate(0, 1, 0).Add(DailyRetention)
+}
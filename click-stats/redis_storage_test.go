@@ -0,0 +1,51 @@
+package click_stats
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/zhuyst/shorturl-service/helper"
+	"os"
+	"testing"
+	"time"
+)
+
+// miniredis不支持HyperLogLog，需要真实的Redis，例如 docker run -d -p 6379:6379 redis:5-alpine
+// SHORTURL_SERVICE_TEST_REDIS=localhost:6379
+const testRedisEnv = "SHORTURL_SERVICE_TEST_REDIS"
+
+func TestRedisStorage(t *testing.T) {
+	testStorage(t, NewRedisStorage(helper.NewTestRedisClient()))
+}
+
+func TestRedisStorage_Expire(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	storage := NewRedisStorage(redisClient)
+	now := time.Now()
+	if err := storage.Incr("4dUaeq5", now, false); err != nil {
+		t.Errorf("RedisStorage_Incr ERROR: %s", err.Error())
+		return
+	}
+
+	hashKey, _, _ := bucketField("4dUaeq5", IntervalHour, now.UTC())
+	ttl := redisClient.TTL(hashKey).Val()
+	if ttl <= HourlyRetention || ttl > HourlyRetention+24*time.Hour {
+		t.Errorf("RedisStorage_Expire ERROR, expected ttl within %s, got %s", HourlyRetention+24*time.Hour, ttl)
+		return
+	}
+
+	t.Logf("RedisStorage_Expire PASS")
+}
+
+func TestRedisStorage_Visitors(t *testing.T) {
+	addr := os.Getenv(testRedisEnv)
+	if addr == "" {
+		t.Skipf("%s not set, skip", testRedisEnv)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{Addr: addr})
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for i := -1; i < 2; i++ {
+		redisClient.Del(visitorsKey("4dUaeq5", day.AddDate(0, 0, i)))
+	}
+
+	testStorageVisitors(t, NewRedisStorage(redisClient))
+}
@@ -0,0 +1,52 @@
+package shorturl_service
+
+// 错误码，客户端应根据result.ErrorCode而不是Message判断错误，已发布的错误码不能修改含义
+const (
+	ErrorCodeInvalidBody           = "INVALID_BODY"
+	ErrorCodeUrlRequired           = "URL_REQUIRED"
+	ErrorCodeInvalidUrl            = "INVALID_URL"
+	ErrorCodeInvalidAlias          = "INVALID_ALIAS"
+	ErrorCodeAliasReserved         = "ALIAS_RESERVED"
+	ErrorCodeInvalidExpiry         = "INVALID_EXPIRY"
+	ErrorCodeInvalidTitle          = "INVALID_TITLE"
+	ErrorCodeInvalidDescription    = "INVALID_DESCRIPTION"
+	ErrorCodeInvalidTags           = "INVALID_TAGS"
+	ErrorCodeInvalidRedirectStatus = "INVALID_REDIRECT_STATUS"
+	ErrorCodeInvalidPassthrough    = "INVALID_PASSTHROUGH"
+	ErrorCodeInvalidBatchSize      = "INVALID_BATCH_SIZE"
+	ErrorCodeKeyRequired           = "KEY_REQUIRED"
+	ErrorCodeInvalidShortUrl       = "INVALID_SHORT_URL"
+	ErrorCodeInvalidCount          = "INVALID_COUNT"
+	ErrorCodeInvalidTime           = "INVALID_TIME"
+	ErrorCodeInvalidCursor         = "INVALID_CURSOR"
+	ErrorCodeInvalidInterval       = "INVALID_INTERVAL"
+	ErrorCodeKeyTaken              = "KEY_TAKEN"
+	ErrorCodeNotFound              = "NOT_FOUND"
+	ErrorCodeStorageUnavailable    = "STORAGE_UNAVAILABLE"
+	ErrorCodeNotSupported          = "NOT_SUPPORTED"
+)
+
+var errorCodes = []string{
+	ErrorCodeInvalidBody,
+	ErrorCodeUrlRequired,
+	ErrorCodeInvalidUrl,
+	ErrorCodeInvalidAlias,
+	ErrorCodeAliasReserved,
+	ErrorCodeInvalidExpiry,
+	ErrorCodeInvalidTitle,
+	ErrorCodeInvalidDescription,
+	ErrorCodeInvalidTags,
+	ErrorCodeInvalidRedirectStatus,
+	ErrorCodeInvalidPassthrough,
+	ErrorCodeInvalidBatchSize,
+	ErrorCodeKeyRequired,
+	ErrorCodeInvalidShortUrl,
+	ErrorCodeInvalidCount,
+	ErrorCodeInvalidTime,
+	ErrorCodeInvalidCursor,
+	ErrorCodeInvalidInterval,
+	ErrorCodeKeyTaken,
+	ErrorCodeNotFound,
+	ErrorCodeStorageUnavailable,
+	ErrorCodeNotSupported,
+}
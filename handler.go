@@ -1,61 +1,632 @@
 package shorturl_service
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/zhuyst/shorturl-service/click-event"
+	"github.com/zhuyst/shorturl-service/click-stats"
 	"github.com/zhuyst/shorturl-service/logger"
+	"github.com/zhuyst/shorturl-service/url-storage"
+	"html"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// inspection 链接检查结果，链接不存在时State为空
+type inspection struct {
+	Key    string `json:"key"`
+	Exists bool   `json:"exists"`
+	State  string `json:"state,omitempty"`
+}
+
+// linkStats 链接的访问统计，Series为按Interval划分的点击数，Bots为查询范围内爬虫的访问数，
+// Visitors为查询范围所在各天去重后的独立访客估计值，Clicks与Visitors都不包括爬虫
+type linkStats struct {
+	Key      string                `json:"key"`
+	Clicks   int64                 `json:"clicks"`
+	Bots     int64                 `json:"bots"`
+	Visitors int64                 `json:"visitors"`
+	Interval string                `json:"interval"`
+	Series   []*click_stats.Bucket `json:"series"`
+}
+
 type result struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Url     string `json:"url"`
+
+	// 出错时的错误码，见ErrorCode开头的常量
+	ErrorCode string `json:"error_code,omitempty"`
+
+	Link *url_storage.Link `json:"link,omitempty"`
+
+	// 参数校验失败时每个字段的错误信息与错误码
+	Errors     map[string]string `json:"errors,omitempty"`
+	ErrorCodes map[string]string `json:"error_codes,omitempty"`
+
+	Inspection *inspection `json:"inspection,omitempty"`
+
+	// 列表接口的当前页与下一页游标，游标为空时已到最后一页
+	Links  []*url_storage.Link `json:"links,omitempty"`
+	Cursor string              `json:"cursor,omitempty"`
+
+	// 批量接口中每个URL各自的结果
+	Items []*result `json:"items,omitempty"`
+
+	Stats *linkStats `json:"stats,omitempty"`
 }
 
+// redirectLongUrl 同时处理/:key与/:key/*path，多余的路径只对开启透传的链接有效
 func (option *Option) redirectLongUrl(c *gin.Context) {
 	key := c.Param("key")
-	longUrl, err := option.urlStorage.GetLongUrlByKey(key)
-	if err != nil {
+	extraPath := c.Param("path")
+
+	// 末尾多出的斜杠不算多余的路径，与/:key一样跳转
+	if extraPath == "/" {
+		extraPath = ""
+	}
+
+	link, err := option.urlStorage.ResolveLink(key)
+	if err == url_storage.ErrDisabled {
+		option.disabledResponse(c, key)
+		return
+	}
+	if err == url_storage.ErrExpired {
+		c.String(http.StatusGone, "%s expired", key)
+		return
+	}
+	if err != nil || (extraPath != "" && link.Passthrough == "") {
 		c.String(http.StatusNotFound, "%s not found", key)
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, longUrl)
+	targetUrl, err := link.TargetUrl(extraPath, c.Request.URL.Query())
+	if err != nil {
+		logger.Error("redirectLongUrl FAIL, key: %s, Error: %s", key, err.Error())
+		c.String(http.StatusInternalServerError, "%s invalid long url", key)
+		return
+	}
+
+	status := link.RedirectStatus
+	if status == 0 {
+		status = option.RedirectStatus
+	}
+	bot := option.botDetector.IsBot(c.Request.UserAgent())
+	if !bot {
+		option.urlStorage.RecordClick(key)
+	}
+	option.writeClickEvent(c, key, bot)
+
+	if bot && option.BotMetadata {
+		botMetadata(c, link, targetUrl)
+		return
+	}
+	c.Redirect(status, targetUrl)
+}
+
+// botMetadataPage 返回给爬虫的轻量页面，链接预览使用其中的Open Graph标签
+const botMetadataPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+<meta property="og:title" content="%[1]s">
+<meta property="og:description" content="%[2]s">
+<meta property="og:url" content="%[3]s">
+<link rel="canonical" href="%[3]s">
+</head>
+<body><a href="%[3]s">%[1]s</a></body>
+</html>
+`
+
+// botMetadata 未设置标题时使用长URL作为标题
+func botMetadata(c *gin.Context, link *url_storage.Link, targetUrl string) {
+	title := link.Title
+	if title == "" {
+		title = targetUrl
+	}
+
+	page := fmt.Sprintf(botMetadataPage, html.EscapeString(title),
+		html.EscapeString(link.Description), html.EscapeString(targetUrl))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// writeClickEvent 统计在内存中累加，ClickSink的缓冲区已满时丢弃事件，都不影响跳转
+func (option *Option) writeClickEvent(c *gin.Context, key string, bot bool) {
+	event := &click_event.Event{
+		Key:            key,
+		Time:           time.Now(),
+		Referrer:       c.Request.Referer(),
+		UserAgent:      c.Request.UserAgent(),
+		ClientIp:       c.ClientIP(),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		Bot:            bot,
+	}
+
+	option.clickStats.Write(event)
+	if option.clickEvents != nil {
+		option.clickEvents.Write(event)
+	}
+}
+
+func (option *Option) disabledResponse(c *gin.Context, key string) {
+	if option.DisabledPage != "" {
+		c.Data(option.DisabledStatus, "text/html; charset=utf-8", []byte(option.DisabledPage))
+		return
+	}
+	c.String(option.DisabledStatus, "%s disabled", key)
 }
 
 func (option *Option) generateShortUrl(c *gin.Context) {
-	longUrl, exists := c.GetPostForm("url")
-	if !exists {
-		c.JSON(http.StatusBadRequest, &result{
-			Code:    http.StatusBadRequest,
-			Message: "required url",
-		})
+	request, verr := bindCreateRequest(c)
+	if verr != nil {
+		badRequest(c, verr)
 		return
 	}
 
-	if !option.LongUrlRegexp.MatchString(longUrl) {
-		c.JSON(http.StatusBadRequest, &result{
-			Code:    http.StatusBadRequest,
-			Message: "need prefix with https://",
+	link, verr := option.newLink(c, request)
+	if verr != nil {
+		badRequest(c, verr)
+		return
+	}
+
+	shortUrl, err := option.urlStorage.CreateLink(link)
+	if err == url_storage.ErrKeyExists && request.Alias != "" {
+		c.JSON(http.StatusConflict, aliasTakenResult(request.Alias))
+		return
+	}
+	if err != nil {
+		logger.Error("generateShortUrl FAIL, longUrl: %s, Error: %s", link.LongUrl, err.Error())
+
+		c.JSON(http.StatusInternalServerError, storageErrorResult(err))
+		return
+	}
+
+	logger.Info("generateShortUrl SUCCESS, %s - %s", shortUrl, link.LongUrl)
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     shortUrl,
+	})
+}
+
+func badRequest(c *gin.Context, verr *validationError) {
+	c.JSON(http.StatusBadRequest, badRequestResult(verr))
+}
+
+func badRequestResult(verr *validationError) *result {
+	return &result{
+		Code:       http.StatusBadRequest,
+		Message:    verr.Error(),
+		ErrorCode:  verr.firstCode,
+		Errors:     verr.Fields,
+		ErrorCodes: verr.Codes,
+	}
+}
+
+// batchGenerateShortUrl 请求体为createRequest的JSON数组，每个URL单独校验，
+// 响应中的items与请求一一对应，部分失败时整体仍返回200
+func (option *Option) batchGenerateShortUrl(c *gin.Context) {
+	var requests []createRequest
+	if err := c.ShouldBindJSON(&requests); err != nil {
+		verr := &validationError{}
+		verr.add("body", ErrorCodeInvalidBody, "need JSON array of urls: "+err.Error())
+		badRequest(c, verr)
+		return
+	}
+
+	if len(requests) == 0 || len(requests) > option.MaxBatchSize {
+		verr := &validationError{}
+		verr.add("body", ErrorCodeInvalidBatchSize, fmt.Sprintf("need 1-%d urls", option.MaxBatchSize))
+		badRequest(c, verr)
+		return
+	}
+
+	items := make([]*result, len(requests))
+	links := make([]*url_storage.Link, 0, len(requests))
+	index := make([]int, 0, len(requests))
+	for i := range requests {
+		link, verr := option.newLink(c, &requests[i])
+		if verr != nil {
+			items[i] = badRequestResult(verr)
+			continue
+		}
+
+		links = append(links, link)
+		index = append(index, i)
+	}
+
+	for j, err := range option.urlStorage.CreateLinks(links) {
+		i, link := index[j], links[j]
+		switch {
+		case err == nil:
+			items[i] = &result{
+				Code:    http.StatusOK,
+				Message: "OK",
+				Url:     option.urlStorage.ShortUrl(link.Key),
+			}
+		case err == url_storage.ErrKeyExists && requests[i].Alias != "":
+			items[i] = aliasTakenResult(requests[i].Alias)
+		default:
+			logger.Error("batchGenerateShortUrl FAIL, longUrl: %s, Error: %s", link.LongUrl, err.Error())
+			items[i] = storageErrorResult(err)
+		}
+	}
+
+	logger.Info("batchGenerateShortUrl SUCCESS, %d urls", len(requests))
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Items:   items,
+	})
+}
+
+func aliasTakenResult(alias string) *result {
+	message := fmt.Sprintf("alias %s is taken", alias)
+	return &result{
+		Code:       http.StatusConflict,
+		Message:    message,
+		ErrorCode:  ErrorCodeKeyTaken,
+		Errors:     map[string]string{"alias": message},
+		ErrorCodes: map[string]string{"alias": ErrorCodeKeyTaken},
+	}
+}
+
+func (option *Option) getLinkMetadata(c *gin.Context) {
+	key := c.Param("key")
+	link, err := option.urlStorage.GetLinkByKey(key)
+	if err != nil {
+		option.linkError(c, "getLinkMetadata", key, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Link:    publicLink(link),
+	})
+}
+
+// publicLink 无需鉴权的接口只返回链接的公开信息，创建者、客户端IP等只能通过管理接口查看
+func publicLink(link *url_storage.Link) *url_storage.Link {
+	return &url_storage.Link{
+		Key:         link.Key,
+		LongUrl:     link.LongUrl,
+		CreatedAt:   link.CreatedAt,
+		NodeId:      link.NodeId,
+		Title:       link.Title,
+		Description: link.Description,
+	}
+}
+
+// getLinkDetail 管理接口，返回包括创建者、客户端IP与User-Agent在内的完整链接
+func (option *Option) getLinkDetail(c *gin.Context) {
+	key := c.Param("key")
+	link, err := option.urlStorage.GetLinkByKey(key)
+	if err != nil {
+		option.linkError(c, "getLinkDetail", key, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Link:    link,
+	})
+}
+
+// getLinkStats 返回总点击数与[from, to)内的时间序列，
+// interval默认为day，未指定to时为当前时间，未指定from时day向前7天、hour向前24小时
+func (option *Option) getLinkStats(c *gin.Context) {
+	verr := &validationError{}
+	interval := c.DefaultQuery("interval", click_stats.IntervalDay)
+	defaultRange := defaultDailyRange
+	switch interval {
+	case click_stats.IntervalDay:
+	case click_stats.IntervalHour:
+		defaultRange = defaultHourlyRange
+	default:
+		verr.add("interval", ErrorCodeInvalidInterval, click_stats.ErrInvalidInterval.Error())
+	}
+
+	from := parseTimeQuery(c, verr, "from")
+	to := parseTimeQuery(c, verr, "to")
+	if !verr.empty() {
+		badRequest(c, verr)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultRange)
+	}
+
+	key := c.Param("key")
+	clicks, err := option.urlStorage.Clicks(key)
+	if err != nil {
+		option.linkError(c, "getLinkStats", key, err)
+		return
+	}
+
+	series, err := option.clickStats.Series(key, interval, from, to)
+	if err == click_stats.ErrInvalidRange {
+		verr.add("from", ErrorCodeInvalidTime, fmt.Sprintf(
+			"from need before to, and range can not be more than %s for hour, %s for day",
+			click_stats.HourlyRetention, click_stats.DailyRetention))
+		badRequest(c, verr)
+		return
+	}
+	if err != nil {
+		logger.Error("getLinkStats FAIL, key: %s, Error: %s", key, err.Error())
+		c.JSON(http.StatusInternalServerError, storageErrorResult(err))
+		return
+	}
+
+	// series的范围已通过校验，按小时统计时范围不超过7天，同样在按天统计的保留时长内
+	daily, visitors, err := option.clickStats.Visitors(key, from, to)
+	if err != nil {
+		logger.Error("getLinkStats FAIL, key: %s, Error: %s", key, err.Error())
+		c.JSON(http.StatusInternalServerError, storageErrorResult(err))
+		return
+	}
+	var bots int64
+	for i, bucket := range series {
+		bots += bucket.Bots
+		if interval == click_stats.IntervalDay {
+			bucket.Visitors = daily[i]
+		}
+	}
+
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Stats: &linkStats{
+			Key:      key,
+			Clicks:   clicks,
+			Bots:     bots,
+			Visitors: visitors,
+			Interval: interval,
+			Series:   series,
+		},
+	})
+}
+
+func (option *Option) deleteLink(c *gin.Context) {
+	key := c.Param("key")
+	if err := option.urlStorage.DeleteLink(key); err != nil {
+		option.linkError(c, "deleteLink", key, err)
+		return
+	}
+
+	logger.Info("deleteLink SUCCESS, key: %s, operator: %s", key, option.CreatorFunc(c))
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+	})
+}
+
+// inspectLink 查询链接的去向与状态而不跳转，key可以是短key或完整的短URL
+func (option *Option) inspectLink(c *gin.Context) {
+	verr := &validationError{}
+	key := option.parseShortKey(verr, c.Query("key"))
+	if !verr.empty() {
+		badRequest(c, verr)
+		return
+	}
+
+	link, err := option.urlStorage.GetLinkByKey(key)
+	if err == url_storage.ErrNotFound {
+		c.JSON(http.StatusOK, &result{
+			Code:       http.StatusOK,
+			Message:    "OK",
+			Url:        option.urlStorage.ShortUrl(key),
+			Inspection: &inspection{Key: key},
 		})
 		return
 	}
+	if err != nil {
+		option.linkError(c, "inspectLink", key, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Link:    publicLink(link),
+		Inspection: &inspection{
+			Key:    key,
+			Exists: true,
+			State:  link.State(time.Now()),
+		},
+	})
+}
 
-	shortUrl, err := option.urlStorage.GenerateShortUrl(longUrl)
+// parseShortKey 从短key或完整短URL（可以省略协议）中解析出key
+func (option *Option) parseShortKey(verr *validationError, value string) string {
+	if value == "" {
+		verr.add("key", ErrorCodeKeyRequired, "required key")
+		return ""
+	}
+	if !strings.Contains(value, "/") {
+		return value
+	}
+
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	shortUrl, err := url.Parse(value)
 	if err != nil {
-		logger.Error("generateShortUrl FAIL, longUrl: %s, Error: %s", longUrl, err.Error())
+		verr.add("key", ErrorCodeInvalidShortUrl, fmt.Sprintf("invalid short url %s", value))
+		return ""
+	}
+	if !strings.EqualFold(shortUrl.Host, option.Domain) || !strings.HasPrefix(shortUrl.Path, option.ServiceUri) {
+		verr.add("key", ErrorCodeInvalidShortUrl,
+			fmt.Sprintf("%s is not a short url of %s%s", value, option.Domain, option.ServiceUri))
+		return ""
+	}
+
+	key := strings.TrimPrefix(shortUrl.Path, option.ServiceUri)
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+	if key == "" {
+		verr.add("key", ErrorCodeInvalidShortUrl, fmt.Sprintf("%s has no key", value))
+	}
+	return key
+}
+
+// listLinks 按游标分页列出链接，可按创建时间范围与长URL的主机名过滤
+func (option *Option) listLinks(c *gin.Context) {
+	verr := &validationError{}
+
+	count := int64(defaultListCount)
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 || n > maxListCount {
+			verr.add("count", ErrorCodeInvalidCount, fmt.Sprintf("count need 1-%d", maxListCount))
+		}
+		count = n
+	}
+
+	filter := &url_storage.LinkFilter{
+		CreatedAfter:  parseTimeQuery(c, verr, "created_after"),
+		CreatedBefore: parseTimeQuery(c, verr, "created_before"),
+		Host:          c.Query("host"),
+	}
+
+	if !verr.empty() {
+		badRequest(c, verr)
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, &result{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
+	links, cursor, err := option.urlStorage.ListLinks(c.Query("cursor"), count, filter)
+	if err == url_storage.ErrInvalidCursor {
+		verr.add("cursor", ErrorCodeInvalidCursor, "invalid cursor")
+		badRequest(c, verr)
+		return
+	}
+	if err == url_storage.ErrNotSupported {
+		c.JSON(http.StatusNotImplemented, &result{
+			Code:      http.StatusNotImplemented,
+			Message:   "list links not supported by storage",
+			ErrorCode: ErrorCodeNotSupported,
 		})
 		return
 	}
+	if err != nil {
+		logger.Error("listLinks FAIL, Error: %s", err.Error())
+
+		c.JSON(http.StatusInternalServerError, storageErrorResult(err))
+		return
+	}
 
-	logger.Info("generateShortUrl SUCCESS, %s - %s", shortUrl, longUrl)
 	c.JSON(http.StatusOK, &result{
 		Code:    http.StatusOK,
 		Message: "OK",
-		Url:     shortUrl,
+		Links:   links,
+		Cursor:  cursor,
+	})
+}
+
+// parseTimeQuery 解析RFC3339格式的查询参数，未指定时返回零值
+func parseTimeQuery(c *gin.Context, verr *validationError, field string) time.Time {
+	value := c.Query(field)
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		verr.add(field, ErrorCodeInvalidTime, field+" need RFC3339 format, e.g. 2019-04-01T00:00:00+08:00")
+	}
+	return t
+}
+
+func (option *Option) updateLink(c *gin.Context) {
+	key := c.Param("key")
+
+	request := &updateRequest{}
+	verr := &validationError{}
+	if err := c.ShouldBind(request); err != nil {
+		verr.add("body", ErrorCodeInvalidBody, "invalid request body: "+err.Error())
+	} else {
+		option.validateLongUrl(verr, request.Url)
+	}
+	if !verr.empty() {
+		badRequest(c, verr)
+		return
+	}
+
+	link, err := option.urlStorage.UpdateLongUrl(key, request.Url)
+	if err != nil {
+		option.linkError(c, "updateLink", key, err)
+		return
+	}
+
+	logger.Info("updateLink SUCCESS, %s - %s, operator: %s", key, link.LongUrl, option.CreatorFunc(c))
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Link:    link,
 	})
 }
+
+func (option *Option) disableLink(c *gin.Context) {
+	option.setLinkDisabled(c, "disableLink", option.urlStorage.DisableLink)
+}
+
+func (option *Option) enableLink(c *gin.Context) {
+	option.setLinkDisabled(c, "enableLink", option.urlStorage.EnableLink)
+}
+
+func (option *Option) setLinkDisabled(c *gin.Context, action string,
+	setDisabled func(key string) (*url_storage.Link, error)) {
+
+	key := c.Param("key")
+	link, err := setDisabled(key)
+	if err != nil {
+		option.linkError(c, action, key, err)
+		return
+	}
+
+	logger.Info("%s SUCCESS, key: %s, operator: %s", action, key, option.CreatorFunc(c))
+	c.JSON(http.StatusOK, &result{
+		Code:    http.StatusOK,
+		Message: "OK",
+		Url:     option.urlStorage.ShortUrl(key),
+		Link:    link,
+	})
+}
+
+// linkError 按key操作链接失败时的响应，不存在返回404，其他错误返回500
+func (option *Option) linkError(c *gin.Context, action string, key string, err error) {
+	if err == url_storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, &result{
+			Code:      http.StatusNotFound,
+			Message:   key + " not found",
+			ErrorCode: ErrorCodeNotFound,
+		})
+		return
+	}
+
+	logger.Error("%s FAIL, key: %s, Error: %s", action, key, err.Error())
+	c.JSON(http.StatusInternalServerError, storageErrorResult(err))
+}
+
+func storageErrorResult(err error) *result {
+	return &result{
+		Code:      http.StatusInternalServerError,
+		Message:   err.Error(),
+		ErrorCode: ErrorCodeStorageUnavailable,
+	}
+}
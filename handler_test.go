@@ -2,13 +2,18 @@ package shorturl_service
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/zhuyst/shorturl-service/click-event"
+	"github.com/zhuyst/shorturl-service/key-generator"
+	"github.com/zhuyst/shorturl-service/url-storage"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 const longUrl = `https://github.com/zhuyst/shorturl-service`
@@ -134,12 +139,1113 @@ func testRedirectLongUrl(t *testing.T, r *gin.Engine, key string) {
 }
 
 func getGenerateShortUrlRecorder(r *gin.Engine, longUrl string) *httptest.ResponseRecorder {
+	return postGenerateShortUrlForm(r, url.Values{"url": {longUrl}})
+}
+
+func TestGetLinkMetadata(t *testing.T) {
+	r := initTestRouter(t)
+
 	form := url.Values{}
 	form.Add("url", longUrl)
+	form.Add("title", "shorturl-service")
 	req := httptest.NewRequest(http.MethodPost, "/new", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "shorturl-test")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var generateResult result
+	if err := json.Unmarshal(w.Body.Bytes(), &generateResult); err != nil {
+		t.Errorf("GetLinkMetadata jsonParseError: %s", err.Error())
+		return
+	}
+	key := strings.TrimPrefix(generateResult.Url, "https://d.zhuyst.cc/")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/meta/"+key, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GetLinkMetadata ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	var metadataResult result
+	if err := json.Unmarshal(w.Body.Bytes(), &metadataResult); err != nil {
+		t.Errorf("GetLinkMetadata jsonParseError: %s", err.Error())
+		return
+	}
+
+	link := metadataResult.Link
+	if link == nil || link.Key != key || link.LongUrl != longUrl ||
+		link.Title != "shorturl-service" || link.CreatedAt.IsZero() {
+		t.Errorf("GetLinkMetadata ERROR, got %s", w.Body.String())
+		return
+	}
+
+	// 创建者信息不对外公开
+	if link.UserAgent != "" || link.ClientIp != "" || link.Creator != "" {
+		t.Errorf("GetLinkMetadata ERROR, expected no creator data, got %s", w.Body.String())
+		return
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/meta/zhuyst", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GetLinkMetadata ERROR, expected 404, got %d", w.Code)
+		return
+	}
+
+	t.Logf("GetLinkMetadata PASS")
+}
+
+func TestGenerateShortUrlExpire(t *testing.T) {
+	storage := url_storage.NewMemoryStorage()
+	r := gin.Default()
+	if err := InitRouter(r, nil, &Option{
+		Domain:  "d.zhuyst.cc",
+		Storage: storage,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+	}
+
+	t.Run("expire_in", func(t *testing.T) {
+		w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "expire_in": {"1h"}})
+		if w.Code != http.StatusOK {
+			t.Errorf("GenerateShortUrlExpire ERROR, expected 200, got %d", w.Code)
+			return
+		}
+
+		var result result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		key := strings.TrimPrefix(result.Url, "https://d.zhuyst.cc/")
+
+		link, err := storage.Get(key)
+		if err != nil || link.ExpireAt == nil || link.ExpireAt.Before(time.Now().Add(59*time.Minute)) {
+			t.Errorf("GenerateShortUrlExpire ERROR, expected expire_at after 1h, got %+v", link)
+			return
+		}
+
+		testRedirectLongUrl(t, r, key)
+	})
+
+	for name, form := range map[string]url.Values{
+		"invalid expire_in": {"url": {longUrl}, "expire_in": {"tomorrow"}},
+		"invalid expire_at": {"url": {longUrl}, "expire_at": {"2019-04-01"}},
+		"past expire_at":    {"url": {longUrl}, "expire_at": {"2019-04-01T00:00:00+08:00"}},
+		"both":              {"url": {longUrl}, "expire_in": {"1h"}, "expire_at": {"2099-04-01T00:00:00+08:00"}},
+	} {
+		form := form
+		t.Run(name, func(t *testing.T) {
+			w := postGenerateShortUrlForm(r, form)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("GenerateShortUrlExpire %s ERROR, expected %d, got %d",
+					name, http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestRedirectLongUrlExpired(t *testing.T) {
+	storage := url_storage.NewMemoryStorage()
+	r := gin.Default()
+	if err := InitRouter(r, nil, &Option{
+		Domain:  "d.zhuyst.cc",
+		Storage: storage,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+	}
+
+	expireAt := time.Now().Add(-time.Minute)
+	storage.Save(&url_storage.Link{
+		Key:      "expired",
+		LongUrl:  longUrl,
+		ExpireAt: &expireAt,
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/expired", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("RedirectLongUrlExpired ERROR, expected %d, got %d", http.StatusGone, w.Code)
+		return
+	}
+
+	t.Logf("RedirectLongUrlExpired PASS")
+}
+
+func postGenerateShortUrlForm(r *gin.Engine, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/new", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGenerateShortUrlAlias(t *testing.T) {
+	r := initTestRouter(t)
+
+	w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"launch2026"}})
+	if w.Code != http.StatusOK {
+		t.Errorf("GenerateShortUrlAlias ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Url != "https://d.zhuyst.cc/launch2026" {
+		t.Errorf("GenerateShortUrlAlias ERROR, expected https://d.zhuyst.cc/launch2026, got %s", result.Url)
+		return
+	}
+	testRedirectLongUrl(t, r, "launch2026")
+
+	w = postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"launch2026"}})
+	if w.Code != http.StatusConflict {
+		t.Errorf("GenerateShortUrlAlias ERROR, expected %d, got %d", http.StatusConflict, w.Code)
+		return
+	}
+
+	for _, alias := range []string{"NEW", "meta", "abc", "launch/2026", "发布会2026"} {
+		w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {alias}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GenerateShortUrlAlias %s ERROR, expected %d, got %d",
+				alias, http.StatusBadRequest, w.Code)
+			return
+		}
+	}
+
+	t.Logf("GenerateShortUrlAlias PASS")
+}
+
+func postGenerateShortUrlJson(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGenerateShortUrlJson(t *testing.T) {
+	storage := url_storage.NewMemoryStorage()
+	r := gin.Default()
+	if err := InitRouter(r, nil, &Option{
+		Domain:  "d.zhuyst.cc",
+		Storage: storage,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+	}
+
+	w := postGenerateShortUrlJson(r, `{"url": "`+longUrl+`", "alias": "json2026",
+		"title": "shorturl-service", "expire_in": "24h", "tags": ["github", "go"]}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("GenerateShortUrlJson ERROR, expected 200, got %d, body: %s", w.Code, w.Body.String())
+		return
+	}
+
+	link, err := storage.Get("json2026")
+	if err != nil || link.Title != "shorturl-service" ||
+		link.ExpireAt == nil || strings.Join(link.Tags, ",") != "github,go" {
+		t.Errorf("GenerateShortUrlJson ERROR, unexpected metadata: %+v", link)
+		return
+	}
+
+	t.Logf("GenerateShortUrlJson PASS")
+}
+
+func TestGenerateShortUrlJsonError(t *testing.T) {
+	r := initTestRouter(t)
+
+	testCases := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"Fields", `{"url": "ftp://github.com", "alias": "new", "expire_in": "-1h"}`,
+			[]string{"url", "alias", "expire_in"}},
+		{"Required", `{"title": "shorturl-service", "tags": [""]}`, []string{"url", "tags"}},
+		{"Type", `{"url": "` + longUrl + `", "tags": "github"}`, []string{"tags"}},
+		{"Body", `{"url": `, []string{"body"}},
+		{"Length", `{"url": "` + longUrl + `", "title": "` + strings.Repeat("标", maxTitleLength+1) +
+			`", "description": "` + strings.Repeat("d", maxDescriptionLength+1) + `"}`,
+			[]string{"title", "description"}},
+	}
+
+	for _, testCase := range testCases {
+		w := postGenerateShortUrlJson(r, testCase.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GenerateShortUrlJson_%s ERROR, expected 400, got %d", testCase.name, w.Code)
+			return
+		}
+
+		var result result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		if len(result.Errors) != len(testCase.fields) {
+			t.Errorf("GenerateShortUrlJson_%s ERROR, expected errors of %v, got %v",
+				testCase.name, testCase.fields, result.Errors)
+			return
+		}
+		for _, field := range testCase.fields {
+			if result.Errors[field] == "" {
+				t.Errorf("GenerateShortUrlJson_%s ERROR, expected error of %s, got %v",
+					testCase.name, field, result.Errors)
+				return
+			}
+		}
+	}
+
+	t.Logf("GenerateShortUrlJsonError PASS")
+}
+
+func postBatchGenerateShortUrl(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchGenerateShortUrl(t *testing.T) {
+	r := initTestRouter(t)
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"batch2026"}}); w.Code != http.StatusOK {
+		t.Errorf("BatchGenerateShortUrl ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	w := postBatchGenerateShortUrl(r, `[
+		{"url": "`+longUrl+`"},
+		{"url": "ftp://github.com"},
+		{"url": "`+longUrl+`", "alias": "batch2027", "expire_in": "1h"},
+		{"url": "`+longUrl+`", "alias": "batch2026"}
+	]`)
+	if w.Code != http.StatusOK {
+		t.Errorf("BatchGenerateShortUrl ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	expected := []int{http.StatusOK, http.StatusBadRequest, http.StatusOK, http.StatusConflict}
+	if len(result.Items) != len(expected) {
+		t.Errorf("BatchGenerateShortUrl ERROR, expected %d items, got %s", len(expected), w.Body.String())
+		return
+	}
+	for i, item := range result.Items {
+		if item.Code != expected[i] {
+			t.Errorf("BatchGenerateShortUrl ERROR, index %d, expected %d, got %d", i, expected[i], item.Code)
+			return
+		}
+	}
+	if result.Items[1].Errors["url"] == "" {
+		t.Errorf("BatchGenerateShortUrl ERROR, expected url error, got %v", result.Items[1].Errors)
+		return
+	}
+
+	testRedirectLongUrl(t, r, strings.TrimPrefix(result.Items[0].Url, "https://d.zhuyst.cc/"))
+	testRedirectLongUrl(t, r, "batch2027")
+
+	for _, body := range []string{`[]`, `{"url": "` + longUrl + `"}`} {
+		if w := postBatchGenerateShortUrl(r, body); w.Code != http.StatusBadRequest {
+			t.Errorf("BatchGenerateShortUrl %s ERROR, expected 400, got %d", body, w.Code)
+			return
+		}
+	}
+
+	t.Logf("BatchGenerateShortUrl PASS")
+}
+
+func serveLinkAdmin(r *gin.Engine, method string, path string, auth bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if auth {
+		req.SetBasicAuth("admin", "secret")
+	}
 
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	return w
 }
+
+func TestLinkAdmin(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:       "d.zhuyst.cc",
+		AdminAuth:    gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+		DisabledPage: "<h1>link disabled</h1>",
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"admin2026"}}); w.Code != http.StatusOK {
+		t.Errorf("LinkAdmin ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	if w := serveLinkAdmin(r, http.MethodDelete, "/link/admin2026", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("LinkAdmin ERROR, expected 401, got %d", w.Code)
+		return
+	}
+
+	if w := serveLinkAdmin(r, http.MethodPost, "/link/admin2026/disable", true); w.Code != http.StatusOK {
+		t.Errorf("LinkAdmin_Disable ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	w := serveLinkAdmin(r, http.MethodGet, "/admin2026", false)
+	if w.Code != http.StatusGone || !strings.Contains(w.Body.String(), "link disabled") {
+		t.Errorf("LinkAdmin_Disable ERROR, expected 410 with notice page, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	w = serveLinkAdmin(r, http.MethodGet, "/link", true)
+	var listResult result
+	json.Unmarshal(w.Body.Bytes(), &listResult)
+	if len(listResult.Links) != 1 || !listResult.Links[0].Disabled {
+		t.Errorf("LinkAdmin_Disable ERROR, expected disabled link, got %s", w.Body.String())
+		return
+	}
+
+	if w := serveLinkAdmin(r, http.MethodPost, "/link/admin2026/enable", true); w.Code != http.StatusOK {
+		t.Errorf("LinkAdmin_Enable ERROR, expected 200, got %d", w.Code)
+		return
+	}
+	testRedirectLongUrl(t, r, "admin2026")
+
+	if w := serveLinkAdmin(r, http.MethodDelete, "/link/admin2026", true); w.Code != http.StatusOK {
+		t.Errorf("LinkAdmin_Delete ERROR, expected 200, got %d", w.Code)
+		return
+	}
+	if w := serveLinkAdmin(r, http.MethodGet, "/admin2026", false); w.Code != http.StatusNotFound {
+		t.Errorf("LinkAdmin_Delete ERROR, expected 404, got %d", w.Code)
+		return
+	}
+	if w := serveLinkAdmin(r, http.MethodDelete, "/link/admin2026", true); w.Code != http.StatusNotFound {
+		t.Errorf("LinkAdmin_Delete ERROR, expected 404, got %d", w.Code)
+		return
+	}
+
+	t.Logf("LinkAdmin PASS")
+}
+
+func TestGetLinkDetail(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(5)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+
+	r := gin.Default()
+	err = InitRouter(r, nil, &Option{
+		Domain:       "d.zhuyst.cc",
+		AdminAuth:    gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+		KeyGenerator: keyGenerator,
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/new", strings.NewReader(url.Values{"url": {longUrl}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "shorturl-test")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var generateResult result
+	if err := json.Unmarshal(w.Body.Bytes(), &generateResult); err != nil {
+		t.Errorf("GetLinkDetail jsonParseError: %s", err.Error())
+		return
+	}
+	key := strings.TrimPrefix(generateResult.Url, "https://d.zhuyst.cc/")
+
+	// 公开的元数据包含创建节点
+	if code, result := serveApi(r, http.MethodGet, "/meta/"+key, ""); code != http.StatusOK ||
+		result.Link == nil || result.Link.NodeId != 5 {
+		t.Errorf("GetLinkDetail ERROR, expected node_id 5 in metadata, got %d %+v", code, result.Link)
+		return
+	}
+
+	for _, path := range []string{"/link/" + key + "/detail", "/api/v1/links/" + key + "/detail"} {
+		if w := serveLinkAdmin(r, http.MethodGet, path, false); w.Code != http.StatusUnauthorized {
+			t.Errorf("GetLinkDetail %s ERROR, expected 401, got %d", path, w.Code)
+			return
+		}
+
+		code, result := serveApi(r, http.MethodGet, path, "")
+		if code != http.StatusOK || result.Link == nil || result.Link.NodeId != 5 ||
+			result.Link.UserAgent != "shorturl-test" || result.Link.ClientIp == "" {
+			t.Errorf("GetLinkDetail %s ERROR, expected full link, got %d %+v", path, code, result.Link)
+			return
+		}
+	}
+
+	if code, _ := serveApi(r, http.MethodGet, "/link/notexists/detail", ""); code != http.StatusNotFound {
+		t.Errorf("GetLinkDetail ERROR, expected 404, got %d", code)
+		return
+	}
+
+	t.Logf("GetLinkDetail PASS")
+}
+
+func TestLinkAdminDisabledByDefault(t *testing.T) {
+	r := initTestRouter(t)
+	getGenerateShortUrlRecorder(r, longUrl)
+
+	if w := serveLinkAdmin(r, http.MethodPost, "/link/any/disable", true); w.Code != http.StatusNotFound {
+		t.Errorf("LinkAdminDisabledByDefault ERROR, expected 404, got %d", w.Code)
+		return
+	}
+
+	t.Logf("LinkAdminDisabledByDefault PASS")
+}
+
+func TestUpdateLink(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:    "d.zhuyst.cc",
+		AdminAuth: gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {"https://github.com/zhuyst"}, "alias": {"qrcode2026"}}); w.Code != http.StatusOK {
+		t.Errorf("UpdateLink ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	updateLink := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/link/"+key, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth("admin", "secret")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := updateLink("qrcode2026", `{"url": "ftp://github.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("UpdateLink ERROR, expected 400, got %d", w.Code)
+		return
+	}
+	if w := updateLink("notexists", `{"url": "`+longUrl+`"}`); w.Code != http.StatusNotFound {
+		t.Errorf("UpdateLink ERROR, expected 404, got %d", w.Code)
+		return
+	}
+	if w := updateLink("qrcode2026", `{"url": "`+longUrl+`"}`); w.Code != http.StatusOK {
+		t.Errorf("UpdateLink ERROR, expected 200, got %d", w.Code)
+		return
+	}
+	testRedirectLongUrl(t, r, "qrcode2026")
+
+	if w := serveLinkAdmin(r, http.MethodGet, "/notexists", false); w.Code != http.StatusNotFound {
+		t.Errorf("UpdateLink ERROR, expected notexists not created, got %d", w.Code)
+		return
+	}
+
+	t.Logf("UpdateLink PASS")
+}
+
+func TestInspectLink(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:    "d.zhuyst.cc",
+		AdminAuth: gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"inspect2026"}}); w.Code != http.StatusOK {
+		t.Errorf("InspectLink ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	inspect := func(key string) (int, *result) {
+		w := serveLinkAdmin(r, http.MethodGet, "/inspect?key="+url.QueryEscape(key), false)
+		var result result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, &result
+	}
+
+	for _, key := range []string{"inspect2026", "d.zhuyst.cc/inspect2026", "https://d.zhuyst.cc/inspect2026?from=qrcode"} {
+		code, result := inspect(key)
+		if code != http.StatusOK || result.Inspection == nil || !result.Inspection.Exists ||
+			result.Inspection.State != url_storage.StateActive || result.Link == nil || result.Link.LongUrl != longUrl ||
+			result.Link.ClientIp != "" || result.Link.UserAgent != "" {
+			t.Errorf("InspectLink %s ERROR, unexpected result %d %+v", key, code, result)
+			return
+		}
+	}
+
+	serveLinkAdmin(r, http.MethodPost, "/link/inspect2026/disable", true)
+	if _, result := inspect("inspect2026"); result.Inspection == nil || result.Inspection.State != url_storage.StateDisabled {
+		t.Errorf("InspectLink ERROR, expected disabled, got %+v", result.Inspection)
+		return
+	}
+
+	if code, result := inspect("notexists"); code != http.StatusOK || result.Inspection == nil || result.Inspection.Exists {
+		t.Errorf("InspectLink ERROR, expected not exists, got %d %+v", code, result.Inspection)
+		return
+	}
+
+	for _, key := range []string{"", "https://github.com/inspect2026", "d.zhuyst.cc/"} {
+		if code, _ := inspect(key); code != http.StatusBadRequest {
+			t.Errorf("InspectLink %s ERROR, expected 400, got %d", key, code)
+			return
+		}
+	}
+
+	t.Logf("InspectLink PASS")
+}
+
+func TestListLinks(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:    "d.zhuyst.cc",
+		AdminAuth: gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	createdAfter := time.Now().Add(-time.Second).Format(time.RFC3339)
+	for i := 0; i < 15; i++ {
+		longUrl := "https://github.com/zhuyst"
+		if i%3 == 0 {
+			longUrl = "https://gitee.com/zhuyst"
+		}
+		if w := getGenerateShortUrlRecorder(r, longUrl); w.Code != http.StatusOK {
+			t.Errorf("ListLinks ERROR, expected 200, got %d", w.Code)
+			return
+		}
+	}
+
+	listLinks := func(query url.Values) (int, *result) {
+		w := serveLinkAdmin(r, http.MethodGet, "/link?"+query.Encode(), true)
+		var result result
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, &result
+	}
+
+	keys := make(map[string]bool)
+	query := url.Values{"count": {"4"}, "host": {"GitHub.com"}, "created_after": {createdAfter}}
+	for page := 0; page < 15; page++ {
+		code, result := listLinks(query)
+		if code != http.StatusOK {
+			t.Errorf("ListLinks ERROR, expected 200, got %d", code)
+			return
+		}
+		for _, link := range result.Links {
+			if link.LongUrl != "https://github.com/zhuyst" {
+				t.Errorf("ListLinks ERROR, expected github.com, got %s", link.LongUrl)
+				return
+			}
+			keys[link.Key] = true
+		}
+
+		if result.Cursor == "" {
+			break
+		}
+		query.Set("cursor", result.Cursor)
+	}
+	if len(keys) != 10 {
+		t.Errorf("ListLinks ERROR, expected 10 links, got %d", len(keys))
+		return
+	}
+
+	if _, result := listLinks(url.Values{"created_before": {createdAfter}}); len(result.Links) != 0 {
+		t.Errorf("ListLinks ERROR, expected no links, got %d", len(result.Links))
+		return
+	}
+
+	for _, query := range []url.Values{{"count": {"0"}}, {"created_after": {"yesterday"}}} {
+		if code, _ := listLinks(query); code != http.StatusBadRequest {
+			t.Errorf("ListLinks %s ERROR, expected 400, got %d", query.Encode(), code)
+			return
+		}
+	}
+
+	t.Logf("ListLinks PASS")
+}
+
+func TestListLinksNotSupported(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:    "d.zhuyst.cc",
+		Storage:   minimalStorage{url_storage.NewMemoryStorage()},
+		AdminAuth: gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	w := serveLinkAdmin(r, http.MethodGet, "/link", true)
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusNotImplemented || result.ErrorCode != ErrorCodeNotSupported {
+		t.Errorf("ListLinksNotSupported ERROR, expected 501 %s, got %d %s",
+			ErrorCodeNotSupported, w.Code, result.ErrorCode)
+		return
+	}
+
+	t.Logf("ListLinksNotSupported PASS")
+}
+
+// unavailableStorage 模拟存储不可用
+type unavailableStorage struct {
+	*url_storage.MemoryStorage
+}
+
+func (storage *unavailableStorage) SaveIfAbsent(link *url_storage.Link) error {
+	return errors.New("storage unavailable")
+}
+
+func (storage *unavailableStorage) SaveBatch(links []*url_storage.Link) []error {
+	errs := make([]error, len(links))
+	for i := range errs {
+		errs[i] = errors.New("storage unavailable")
+	}
+	return errs
+}
+
+func (storage *unavailableStorage) Get(key string) (*url_storage.Link, error) {
+	return nil, errors.New("storage unavailable")
+}
+
+func serveApi(r *gin.Engine, method string, path string, body string) (int, *result) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("admin", "secret")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w.Code, &result
+}
+
+func TestApiV1(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:    "d.zhuyst.cc",
+		AdminAuth: gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	code, result := serveApi(r, http.MethodPost, "/api/v1/links", `{"url": "`+longUrl+`", "alias": "api2026"}`)
+	if code != http.StatusOK || result.Url != "https://d.zhuyst.cc/api2026" {
+		t.Errorf("ApiV1 ERROR, expected 200, got %d %+v", code, result)
+		return
+	}
+	testRedirectLongUrl(t, r, "api2026")
+
+	testCases := []struct {
+		method    string
+		path      string
+		body      string
+		code      int
+		errorCode string
+	}{
+		{http.MethodPost, "/api/v1/links", `{}`, http.StatusBadRequest, ErrorCodeUrlRequired},
+		{http.MethodPost, "/api/v1/links", `{"url": "ftp://github.com"}`, http.StatusBadRequest, ErrorCodeInvalidUrl},
+		{http.MethodPost, "/api/v1/links", `{"url": "` + longUrl + `", "alias": "api2026"}`, http.StatusConflict, ErrorCodeKeyTaken},
+		{http.MethodPost, "/api/v1/links", `{"url": "` + longUrl + `", "alias": "api"}`, http.StatusBadRequest, ErrorCodeInvalidAlias},
+		{http.MethodPost, "/api/v1/links", `{"url": "` + longUrl + `", "alias": "inspect"}`, http.StatusBadRequest, ErrorCodeAliasReserved},
+		{http.MethodPost, "/api/v1/links", `{"url": `, http.StatusBadRequest, ErrorCodeInvalidBody},
+		{http.MethodPost, "/api/v1/links", `{"url": "` + longUrl + `", "title": "` + strings.Repeat("t", maxTitleLength+1) + `"}`,
+			http.StatusBadRequest, ErrorCodeInvalidTitle},
+		{http.MethodPost, "/api/v1/links/batch", `[]`, http.StatusBadRequest, ErrorCodeInvalidBatchSize},
+		{http.MethodGet, "/api/v1/links/api2026", ``, http.StatusOK, ""},
+		{http.MethodGet, "/api/v1/links/notexists", ``, http.StatusNotFound, ErrorCodeNotFound},
+		{http.MethodGet, "/api/v1/inspect", ``, http.StatusBadRequest, ErrorCodeKeyRequired},
+		{http.MethodGet, "/api/v1/links?cursor=notexists", ``, http.StatusOK, ""},
+		{http.MethodPost, "/api/v1/links/api2026/disable", ``, http.StatusOK, ""},
+		{http.MethodPost, "/api/v1/links/notexists/enable", ``, http.StatusNotFound, ErrorCodeNotFound},
+		{http.MethodDelete, "/api/v1/links/api2026", ``, http.StatusOK, ""},
+		// 旧路由同样返回错误码
+		{http.MethodPost, "/new", `{"url": "ftp://github.com"}`, http.StatusBadRequest, ErrorCodeInvalidUrl},
+	}
+	for _, testCase := range testCases {
+		code, result := serveApi(r, testCase.method, testCase.path, testCase.body)
+		if code != testCase.code || result.ErrorCode != testCase.errorCode {
+			t.Errorf("ApiV1 %s %s ERROR, expected %d %s, got %d %s", testCase.method, testCase.path,
+				testCase.code, testCase.errorCode, code, result.ErrorCode)
+			return
+		}
+	}
+
+	t.Logf("ApiV1 PASS")
+}
+
+func TestApiV1StorageUnavailable(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:  "d.zhuyst.cc",
+		Storage: &unavailableStorage{url_storage.NewMemoryStorage()},
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	for _, path := range []string{"/api/v1/links", "/api/v1/links/batch"} {
+		body := `{"url": "` + longUrl + `"}`
+		if path == "/api/v1/links/batch" {
+			body = "[" + body + "]"
+		}
+
+		code, result := serveApi(r, http.MethodPost, path, body)
+		if len(result.Items) > 0 {
+			code, result = result.Items[0].Code, result.Items[0]
+		}
+		if code != http.StatusInternalServerError || result.ErrorCode != ErrorCodeStorageUnavailable {
+			t.Errorf("ApiV1StorageUnavailable %s ERROR, expected 500 %s, got %d %s",
+				path, ErrorCodeStorageUnavailable, code, result.ErrorCode)
+			return
+		}
+	}
+
+	if code, result := serveApi(r, http.MethodGet, "/api/v1/links/any", ""); code != http.StatusInternalServerError ||
+		result.ErrorCode != ErrorCodeStorageUnavailable {
+		t.Errorf("ApiV1StorageUnavailable ERROR, expected 500 %s, got %d %s",
+			ErrorCodeStorageUnavailable, code, result.ErrorCode)
+		return
+	}
+
+	t.Logf("ApiV1StorageUnavailable PASS")
+}
+
+func TestRedirectStatus(t *testing.T) {
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain:         "d.zhuyst.cc",
+		RedirectStatus: http.StatusFound,
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	testCases := []struct {
+		alias          string
+		redirectStatus string
+		expected       int
+	}{
+		{"status2026", "", http.StatusFound},
+		{"status2027", "307", http.StatusTemporaryRedirect},
+		{"status2028", "308", http.StatusPermanentRedirect},
+	}
+	for _, testCase := range testCases {
+		form := url.Values{"url": {longUrl}, "alias": {testCase.alias}}
+		if testCase.redirectStatus != "" {
+			form.Set("redirect_status", testCase.redirectStatus)
+		}
+		if w := postGenerateShortUrlForm(r, form); w.Code != http.StatusOK {
+			t.Errorf("RedirectStatus ERROR, expected 200, got %d", w.Code)
+			return
+		}
+
+		w := serveLinkAdmin(r, http.MethodGet, "/"+testCase.alias, false)
+		if w.Code != testCase.expected || w.Header().Get("Location") != longUrl {
+			t.Errorf("RedirectStatus %s ERROR, expected %d, got %d", testCase.alias, testCase.expected, w.Code)
+			return
+		}
+	}
+
+	w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "redirect_status": {"200"}})
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusBadRequest || result.ErrorCode != ErrorCodeInvalidRedirectStatus {
+		t.Errorf("RedirectStatus ERROR, expected 400 %s, got %d %s",
+			ErrorCodeInvalidRedirectStatus, w.Code, result.ErrorCode)
+		return
+	}
+
+	if err := InitRouter(gin.New(), nil, &Option{Domain: "d.zhuyst.cc", RedirectStatus: http.StatusOK}); err == nil {
+		t.Errorf("RedirectStatus ERROR, expected error for RedirectStatus 200, got nil")
+		return
+	}
+
+	t.Logf("RedirectStatus PASS")
+}
+
+func TestRedirectPassthrough(t *testing.T) {
+	r := initTestRouter(t)
+
+	for alias, passthrough := range map[string]string{"pass2026": url_storage.PassthroughKeepTarget, "pass2027": ""} {
+		form := url.Values{"url": {"https://github.com/zhuyst?tab=repositories"}, "alias": {alias},
+			"passthrough": {passthrough}}
+		if w := postGenerateShortUrlForm(r, form); w.Code != http.StatusOK {
+			t.Errorf("RedirectPassthrough ERROR, expected 200, got %d", w.Code)
+			return
+		}
+	}
+
+	testCases := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/pass2026/shorturl-service?tab=stars&utm_source=qrcode", http.StatusMovedPermanently,
+			"https://github.com/zhuyst/shorturl-service?tab=repositories&utm_source=qrcode"},
+		{"/pass2026?utm_source=qrcode", http.StatusMovedPermanently,
+			"https://github.com/zhuyst?tab=repositories&utm_source=qrcode"},
+		{"/pass2027?utm_source=qrcode", http.StatusMovedPermanently, "https://github.com/zhuyst?tab=repositories"},
+		{"/pass2027/", http.StatusMovedPermanently, "https://github.com/zhuyst?tab=repositories"},
+		{"/pass2026/", http.StatusMovedPermanently, "https://github.com/zhuyst?tab=repositories"},
+		{"/pass2027/shorturl-service", http.StatusNotFound, ""},
+		{"/notexists/shorturl-service", http.StatusNotFound, ""},
+	}
+	for _, testCase := range testCases {
+		w := serveLinkAdmin(r, http.MethodGet, testCase.path, false)
+		if w.Code != testCase.code || w.Header().Get("Location") != testCase.location {
+			t.Errorf("RedirectPassthrough %s ERROR, expected %d %s, got %d %s", testCase.path,
+				testCase.code, testCase.location, w.Code, w.Header().Get("Location"))
+			return
+		}
+	}
+
+	w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "passthrough": {"always"}})
+	var result result
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusBadRequest || result.ErrorCode != ErrorCodeInvalidPassthrough {
+		t.Errorf("RedirectPassthrough ERROR, expected 400 %s, got %d %s",
+			ErrorCodeInvalidPassthrough, w.Code, result.ErrorCode)
+		return
+	}
+
+	t.Logf("RedirectPassthrough PASS")
+}
+
+func TestLinkStats(t *testing.T) {
+	r := initTestRouter(t)
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"stats2026"}}); w.Code != http.StatusOK {
+		t.Errorf("LinkStats ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	const clicks = 3
+	for i := 0; i < clicks; i++ {
+		if w := serveLinkAdmin(r, http.MethodGet, "/stats2026", false); w.Code != http.StatusMovedPermanently {
+			t.Errorf("LinkStats ERROR, expected 301, got %d", w.Code)
+			return
+		}
+	}
+
+	// 未写入存储的点击同样计入
+	for _, path := range []string{"/stats/stats2026", "/api/v1/links/stats2026/stats"} {
+		code, result := serveApi(r, http.MethodGet, path, "")
+		if code != http.StatusOK || result.Stats == nil || result.Stats.Clicks != clicks {
+			t.Errorf("LinkStats %s ERROR, expected %d clicks, got %d %+v", path, clicks, code, result.Stats)
+			return
+		}
+	}
+
+	code, result := serveApi(r, http.MethodGet, "/stats/notexists", "")
+	if code != http.StatusNotFound || result.ErrorCode != ErrorCodeNotFound {
+		t.Errorf("LinkStats ERROR, expected 404 %s, got %d %s", ErrorCodeNotFound, code, result.ErrorCode)
+		return
+	}
+
+	t.Logf("LinkStats PASS")
+}
+
+func TestClickEvents(t *testing.T) {
+	events := make(chan *click_event.Event, 1)
+	r := gin.Default()
+	err := InitRouter(r, nil, &Option{
+		Domain: "d.zhuyst.cc",
+		ClickSink: click_event.SinkFunc(func(event *click_event.Event) error {
+			events <- event
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Errorf("InitRouter ERROR: %s", err.Error())
+		return
+	}
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"event2026"}}); w.Code != http.StatusOK {
+		t.Errorf("ClickEvents ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/event2026", nil)
+	req.Header.Set("Referer", "https://github.com/zhuyst")
+	req.Header.Set("User-Agent", "curl/7.64.0")
+	req.Header.Set("Accept-Language", "zh-CN")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("ClickEvents ERROR, expected 301, got %d", w.Code)
+		return
+	}
+
+	select {
+	case event := <-events:
+		if event.Key != "event2026" || event.Referrer != "https://github.com/zhuyst" ||
+			event.UserAgent != "curl/7.64.0" || event.AcceptLanguage != "zh-CN" ||
+			event.ClientIp == "" || event.Time.IsZero() {
+			t.Errorf("ClickEvents ERROR, unexpected event %+v", event)
+			return
+		}
+	case <-time.After(time.Second):
+		t.Errorf("ClickEvents ERROR, event not written after 1s")
+		return
+	}
+
+	t.Logf("ClickEvents PASS")
+}
+
+func TestLinkStatsSeries(t *testing.T) {
+	r := initTestRouter(t)
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"series2026"}}); w.Code != http.StatusOK {
+		t.Errorf("LinkStatsSeries ERROR, expected 200, got %d", w.Code)
+		return
+	}
+	serveLinkAdmin(r, http.MethodGet, "/series2026", false)
+
+	// 点击事件在后台写入统计
+	var stats *linkStats
+	for i := 0; i < 100; i++ {
+		code, result := serveApi(r, http.MethodGet, "/api/v1/links/series2026/stats?interval=hour", "")
+		if code != http.StatusOK || result.Stats == nil {
+			t.Errorf("LinkStatsSeries ERROR, expected 200, got %d", code)
+			return
+		}
+		stats = result.Stats
+		if len(stats.Series) > 0 && stats.Series[len(stats.Series)-1].Clicks == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 默认范围为24小时前所在的小时到当前小时
+	if stats.Interval != "hour" || len(stats.Series) != 25 || stats.Series[len(stats.Series)-1].Clicks != 1 {
+		t.Errorf("LinkStatsSeries ERROR, expected 25 hourly buckets ending with 1 click, got %s %d",
+			stats.Interval, len(stats.Series))
+		return
+	}
+
+	testCases := []struct {
+		query     string
+		errorCode string
+	}{
+		{"interval=week", ErrorCodeInvalidInterval},
+		{"from=yesterday", ErrorCodeInvalidTime},
+		{"from=2026-10-18T00:00:00Z&to=2026-10-17T00:00:00Z", ErrorCodeInvalidTime},
+		{"interval=hour&from=2026-01-01T00:00:00Z&to=2026-10-18T00:00:00Z", ErrorCodeInvalidTime},
+	}
+	for _, testCase := range testCases {
+		code, result := serveApi(r, http.MethodGet, "/stats/series2026?"+testCase.query, "")
+		if code != http.StatusBadRequest || result.ErrorCode != testCase.errorCode {
+			t.Errorf("LinkStatsSeries %s ERROR, expected 400 %s, got %d %s",
+				testCase.query, testCase.errorCode, code, result.ErrorCode)
+			return
+		}
+	}
+
+	t.Logf("LinkStatsSeries PASS")
+}
+
+func TestLinkStatsVisitors(t *testing.T) {
+	r := initTestRouter(t)
+
+	if w := postGenerateShortUrlForm(r, url.Values{"url": {longUrl}, "alias": {"visitor2026"}}); w.Code != http.StatusOK {
+		t.Errorf("LinkStatsVisitors ERROR, expected 200, got %d", w.Code)
+		return
+	}
+	for _, userAgent := range []string{"Mozilla/5.0 (Windows NT 10.0)", "Mozilla/5.0 (Windows NT 10.0)", "Mozilla/5.0"} {
+		req := httptest.NewRequest(http.MethodGet, "/visitor2026", nil)
+		req.Header.Set("User-Agent", userAgent)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 点击事件在后台写入统计
+	var stats *linkStats
+	for i := 0; i < 100; i++ {
+		code, result := serveApi(r, http.MethodGet, "/stats/visitor2026", "")
+		if code != http.StatusOK || result.Stats == nil {
+			t.Errorf("LinkStatsVisitors ERROR, expected 200, got %d", code)
+			return
+		}
+		stats = result.Stats
+		if stats.Visitors == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	today := stats.Series[len(stats.Series)-1]
+	if stats.Clicks != 3 || stats.Visitors != 2 || today.Clicks != 3 || today.Visitors != 2 {
+		t.Errorf("LinkStatsVisitors ERROR, expected 3 clicks 2 visitors, got %d %d, today %d %d",
+			stats.Clicks, stats.Visitors, today.Clicks, today.Visitors)
+		return
+	}
+
+	t.Logf("LinkStatsVisitors PASS")
+}
+
+func TestBotTraffic(t *testing.T) {
+	for _, botMetadata := range []bool{false, true} {
+		r := gin.Default()
+		err := InitRouter(r, nil, &Option{
+			Domain:      "d.zhuyst.cc",
+			BotMetadata: botMetadata,
+		})
+		if err != nil {
+			t.Errorf("InitRouter ERROR: %s", err.Error())
+			return
+		}
+
+		form := url.Values{"url": {longUrl}, "alias": {"bot2026"}, "title": {"<shorturl-service>"}}
+		if w := postGenerateShortUrlForm(r, form); w.Code != http.StatusOK {
+			t.Errorf("BotTraffic ERROR, expected 200, got %d", w.Code)
+			return
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/bot2026", nil)
+		req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if !botMetadata && (w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != longUrl) {
+			t.Errorf("BotTraffic ERROR, expected 301, got %d", w.Code)
+			return
+		}
+		if botMetadata && (w.Code != http.StatusOK ||
+			!strings.Contains(w.Body.String(), `<meta property="og:title" content="&lt;shorturl-service&gt;">`) ||
+			!strings.Contains(w.Body.String(), `<meta property="og:url" content="`+longUrl+`">`)) {
+			t.Errorf("BotTraffic ERROR, expected 200 metadata page, got %d %s", w.Code, w.Body.String())
+			return
+		}
+
+		// 爬虫的访问在后台单独计数，不计入点击数
+		var stats *linkStats
+		for i := 0; i < 100; i++ {
+			_, result := serveApi(r, http.MethodGet, "/stats/bot2026", "")
+			stats = result.Stats
+			if stats != nil && stats.Bots == 1 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stats == nil || stats.Bots != 1 || stats.Clicks != 0 || stats.Visitors != 0 {
+			t.Errorf("BotTraffic ERROR, expected 1 bot 0 clicks, got %+v", stats)
+			return
+		}
+	}
+
+	t.Logf("BotTraffic PASS")
+}
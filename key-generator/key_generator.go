@@ -1,6 +1,7 @@
 package key_generator
 
 import (
+	"fmt"
 	"github.com/bwmarrin/snowflake"
 	"github.com/go-redis/redis"
 	"github.com/zhuyst/shorturl-service/logger"
@@ -23,12 +24,12 @@ func init() {
 type KeyGenerator struct {
 	NodeId int64
 
-	redisClient     *redis.Client
+	redisClient     redis.UniversalClient
 	node            *snowflake.Node
 	nodeIdGenerator *node_id_generator.NodeIdGenerator
 }
 
-func New(redisClient *redis.Client) (*KeyGenerator, error) {
+func New(redisClient redis.UniversalClient) (*KeyGenerator, error) {
 	nodeIdGenerator := node_id_generator.New(redisClient, nodeMax)
 	nodeId, err := nodeIdGenerator.GetNodeId()
 	if err != nil {
@@ -50,6 +51,33 @@ func New(redisClient *redis.Client) (*KeyGenerator, error) {
 	}, nil
 }
 
+// NewLocal 使用指定的NodeId创建，不依赖Redis分配节点，多实例部署时需自行保证NodeId不重复
+func NewLocal(nodeId int64) (*KeyGenerator, error) {
+	if nodeId < 0 || nodeId > nodeMax {
+		return nil, fmt.Errorf("nodeId must be between 0 and %d, got %d", nodeMax, nodeId)
+	}
+
+	node, err := snowflake.NewNode(nodeId)
+	if err != nil {
+		logger.Error("Snowflake NewNode FAIL, Error: %s", err.Error())
+		return nil, err
+	}
+
+	return &KeyGenerator{
+		NodeId: nodeId,
+		node:   node,
+	}, nil
+}
+
 func (generator *KeyGenerator) Generate() string {
 	return generator.node.Generate().Base58()
 }
+
+// GenerateBatch 一次生成n个key
+func (generator *KeyGenerator) GenerateBatch(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = generator.node.Generate().Base58()
+	}
+	return keys
+}
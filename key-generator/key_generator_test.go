@@ -55,7 +55,7 @@ func TestMultiKeyGenerator(t *testing.T) {
 
 			generator, err := New(redisClient)
 			if err != nil {
-				t.Fatalf("NewKeyGenerator %d ERROR: %s", j, err.Error())
+				t.Errorf("NewKeyGenerator %d ERROR: %s", j, err.Error())
 				return
 			}
 			t.Logf("MultiKeyGenerator %d, NodeId: %d", j, generator.NodeId)
@@ -90,7 +90,8 @@ func TestMultiKeyGenerator_Generate(t *testing.T) {
 		go func() {
 			generator, err := New(redisClient)
 			if err != nil {
-				t.Fatalf("NewKeyGenerator ERROR: %s", err.Error())
+				t.Errorf("NewKeyGenerator ERROR: %s", err.Error())
+				waitGroup.Add(-generateNumber)
 				return
 			}
 
@@ -122,6 +123,56 @@ func TestMultiKeyGenerator_Generate(t *testing.T) {
 	t.Log("MultiKeyGenerator_Generate PASS")
 }
 
+func TestNewLocal(t *testing.T) {
+	generator, err := NewLocal(nodeMax)
+	if err != nil {
+		t.Errorf("NewLocal ERROR: %s", err.Error())
+		return
+	}
+
+	if generator.NodeId != nodeMax {
+		t.Errorf("NewLocal ERROR, expected NodeId %d, got %d", nodeMax, generator.NodeId)
+		return
+	}
+
+	if generator.Generate() == "" {
+		t.Errorf("NewLocal ERROR, expected not empty key, got empty key")
+		return
+	}
+
+	if _, err := NewLocal(nodeMax + 1); err == nil {
+		t.Errorf("NewLocal ERROR, expected error for nodeId %d, got nil", nodeMax+1)
+		return
+	}
+
+	t.Logf("NewLocal PASS")
+}
+
+func TestGenerateBatch(t *testing.T) {
+	generator, err := NewLocal(0)
+	if err != nil {
+		t.Errorf("NewLocal ERROR: %s", err.Error())
+		return
+	}
+
+	keys := generator.GenerateBatch(100)
+	if len(keys) != 100 {
+		t.Errorf("GenerateBatch ERROR, expected 100 keys, got %d", len(keys))
+		return
+	}
+
+	keySet := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if keySet[key] {
+			t.Errorf("GenerateBatch ERROR, duplicate key %s", key)
+			return
+		}
+		keySet[key] = true
+	}
+
+	t.Logf("GenerateBatch PASS")
+}
+
 func newKeyGenerator() (*KeyGenerator, error) {
 	redisClient := helper.NewTestRedisClient()
 	return New(redisClient)
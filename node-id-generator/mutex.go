@@ -0,0 +1,67 @@
+package node_id_generator
+
+import (
+	"errors"
+	"github.com/go-redis/redis"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+const (
+	mutexExpiry     = 8 * time.Second
+	mutexTries      = 32
+	mutexRetryDelay = 500 * time.Millisecond
+)
+
+var errLockFailed = errors.New("node_id_generator: failed to acquire lock")
+
+var unlockScript = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	else
+		return 0
+	end
+`)
+
+// redisMutex 基于单个Key的分布式锁，只使用单Key命令与脚本，
+// 可以运行在redis.Client、FailoverClient与ClusterClient上
+type redisMutex struct {
+	name  string
+	value string
+
+	redisClient redis.UniversalClient
+}
+
+func newRedisMutex(redisClient redis.UniversalClient, name string) *redisMutex {
+	return &redisMutex{
+		name:        name,
+		redisClient: redisClient,
+	}
+}
+
+func (m *redisMutex) Lock() error {
+	value := uuid.NewV4().String()
+
+	for i := 0; i < mutexTries; i++ {
+		if i != 0 {
+			time.Sleep(mutexRetryDelay)
+		}
+
+		ok, err := m.redisClient.SetNX(m.name, value, mutexExpiry).Result()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			m.value = value
+			return nil
+		}
+	}
+
+	return errLockFailed
+}
+
+func (m *redisMutex) Unlock() bool {
+	n, err := unlockScript.Run(m.redisClient, []string{m.name}, m.value).Int64()
+	return err == nil && n != 0
+}
@@ -0,0 +1,33 @@
+package node_id_generator
+
+import (
+	"github.com/zhuyst/shorturl-service/helper"
+	"testing"
+)
+
+func TestRedisMutex(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+
+	mutex := newRedisMutex(redisClient, "SHORTURL_SERVICE:TEST_LOCK")
+	if err := mutex.Lock(); err != nil {
+		t.Errorf("RedisMutex_Lock ERROR: %s", err.Error())
+		return
+	}
+
+	if ok := newRedisMutex(redisClient, mutex.name).Unlock(); ok {
+		t.Errorf("RedisMutex_Unlock ERROR, expected other holder can not unlock, got true")
+		return
+	}
+
+	if ok := mutex.Unlock(); !ok {
+		t.Errorf("RedisMutex_Unlock ERROR, expected true, got false")
+		return
+	}
+
+	if err := newRedisMutex(redisClient, mutex.name).Lock(); err != nil {
+		t.Errorf("RedisMutex_Lock after Unlock ERROR: %s", err.Error())
+		return
+	}
+
+	t.Logf("RedisMutex PASS")
+}
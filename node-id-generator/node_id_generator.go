@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/go-redis/redis"
 	"github.com/satori/go.uuid"
-	"github.com/zhuyst/redsync"
 	"github.com/zhuyst/shorturl-service/logger"
 	"os"
 	"os/signal"
@@ -25,27 +24,23 @@ type NodeIdGenerator struct {
 	nodeId  int64
 	nodeMax int64
 
-	redisClient    *redis.Client
-	redSync        *redsync.RedSync
-	getNodeIdMutex *redsync.Mutex
+	redisClient    redis.UniversalClient
+	getNodeIdMutex *redisMutex
 
 	nodeIdKey     string
 	nodeIdLockKey string
-	nodeIdMutex   *redsync.Mutex
+	nodeIdMutex   *redisMutex
 
 	nodeUUID   string
 	nodeHolder *time.Ticker
 }
 
-func New(redisClient *redis.Client, nodeMax int64) *NodeIdGenerator {
-	redSync := redsync.New(redisClient)
-
+func New(redisClient redis.UniversalClient, nodeMax int64) *NodeIdGenerator {
 	return &NodeIdGenerator{
 		nodeId:         -1,
 		nodeMax:        nodeMax,
 		redisClient:    redisClient,
-		redSync:        redSync,
-		getNodeIdMutex: redSync.NewMutex(getNodeIdLockKey),
+		getNodeIdMutex: newRedisMutex(redisClient, getNodeIdLockKey),
 	}
 }
 
@@ -113,7 +108,7 @@ func (generator *NodeIdGenerator) startNodeHolder() error {
 	}
 
 	generator.nodeIdLockKey = fmt.Sprintf("%s:%d", nodeIdLockKeyPrefix, generator.nodeId)
-	generator.nodeIdMutex = generator.redSync.NewMutex(generator.nodeIdLockKey)
+	generator.nodeIdMutex = newRedisMutex(generator.redisClient, generator.nodeIdLockKey)
 
 	logger.Info("startNodeHolder, NodeId: %d, NodeUUID: %s", generator.nodeId, nodeUUID)
 
@@ -158,7 +153,7 @@ func (generator *NodeIdGenerator) resetNodeId() error {
 }
 
 func (generator *NodeIdGenerator) startListenSignal() error {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGKILL,
 		syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
 	go func() {
@@ -166,7 +161,6 @@ func (generator *NodeIdGenerator) startListenSignal() error {
 			if err := generator.redisClient.Del(generator.nodeIdKey).Err(); err != nil {
 				logger.Error("ClearNodeId FAIL, Error: %s", err.Error())
 				panic(err)
-				return
 			}
 
 			logger.Info("ClearNodeId SUCCESS, NodeId: %d", generator.nodeId)
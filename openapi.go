@@ -0,0 +1,314 @@
+package shorturl_service
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zhuyst/shorturl-service/click-stats"
+	"github.com/zhuyst/shorturl-service/url-storage"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type object = map[string]interface{}
+
+// openApiSpec 根据Option生成InitRouter注册的所有路由的OpenAPI 3文档，
+// 新增路由时需要同步修改，TestOpenApiSpec会检查是否有遗漏
+func (option *Option) openApiSpec() object {
+	paths := object{}
+	addPath := func(path string, method string, operation object) {
+		path = openApiPath(path)
+		if paths[path] == nil {
+			paths[path] = object{}
+		}
+		paths[path].(object)[strings.ToLower(method)] = operation
+	}
+
+	create := operation("生成短URL", nil, requestBody("CreateRequest", true),
+		http.StatusOK, http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError)
+	batch := operation("批量生成短URL，items与请求一一对应", nil, object{
+		"required": true,
+		"content": object{
+			"application/json": object{"schema": object{
+				"type":  "array",
+				"items": schemaRef("CreateRequest"),
+			}},
+		},
+	}, http.StatusOK, http.StatusBadRequest)
+	metadata := operation("查询链接元数据", []object{keyParam}, nil,
+		http.StatusOK, http.StatusNotFound, http.StatusInternalServerError)
+	stats := operation("查询链接的总点击数与按小时或天划分的点击数", []object{
+		keyParam,
+		queryParam("interval", "统计粒度，hour或day，默认day", false),
+		queryParam("from", "开始时间，RFC3339格式，默认day向前7天、hour向前24小时", false),
+		queryParam("to", "结束时间，RFC3339格式，默认当前时间", false),
+	}, nil, http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError)
+	inspect := operation("查看链接的去向与状态而不跳转", []object{
+		queryParam("key", "短key或完整的短URL", true),
+	}, nil, http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError)
+
+	list := operation("分页列出链接", []object{
+		queryParam("cursor", "上一页返回的游标", false),
+		queryParam("count", "每页数量", false),
+		queryParam("created_after", "创建时间下限，RFC3339格式", false),
+		queryParam("created_before", "创建时间上限，RFC3339格式", false),
+		queryParam("host", "长URL的主机名", false),
+	}, nil, http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError, http.StatusNotImplemented)
+	detail := operation("查询链接的完整信息，包括创建者、客户端IP与User-Agent", []object{keyParam}, nil,
+		http.StatusOK, http.StatusNotFound, http.StatusInternalServerError)
+	update := operation("修改链接的长URL", []object{keyParam}, requestBody("UpdateRequest", true),
+		http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError)
+	remove := operation("删除链接", []object{keyParam}, nil,
+		http.StatusOK, http.StatusNotFound, http.StatusInternalServerError)
+	disable := operation("禁用链接", []object{keyParam}, nil,
+		http.StatusOK, http.StatusNotFound, http.StatusInternalServerError)
+	enable := operation("恢复被禁用的链接", []object{keyParam}, nil,
+		http.StatusOK, http.StatusNotFound, http.StatusInternalServerError)
+
+	redirect := object{
+		"summary": "跳转到长URL，开启透传的链接会合并多余的路径与查询参数",
+		"parameters": []object{keyParam, object{
+			"name":     "path",
+			"in":       "path",
+			"required": true,
+			"schema":   object{"type": "string"},
+		}},
+		"responses": object{
+			"200": object{"description": "Option.BotMetadata开启时返回给爬虫的元数据页面"},
+			"301": object{"description": "跳转到长URL，状态码由Option.RedirectStatus或链接的redirect_status决定"},
+			"302": object{"description": "跳转到长URL"},
+			"307": object{"description": "跳转到长URL"},
+			"308": object{"description": "跳转到长URL"},
+			"404": object{"description": "链接不存在"},
+			"410": object{"description": "链接已过期或被禁用"},
+		},
+	}
+	addPath(option.ServiceUri+":key", http.MethodGet, object{
+		"summary":    redirect["summary"],
+		"parameters": []object{keyParam},
+		"responses":  redirect["responses"],
+	})
+	addPath(option.ServiceUri+":key/*path", http.MethodGet, redirect)
+	addPath(option.ServiceUri+newRoute, http.MethodPost, create)
+	addPath(option.ServiceUri+batchRoute, http.MethodPost, batch)
+	addPath(option.ServiceUri+metaRoute+"/:key", http.MethodGet, metadata)
+	addPath(option.ServiceUri+inspectRoute, http.MethodGet, inspect)
+	addPath(option.ServiceUri+statsRoute+"/:key", http.MethodGet, stats)
+
+	addPath(option.ApiUri+"/links", http.MethodPost, create)
+	addPath(option.ApiUri+"/links/batch", http.MethodPost, batch)
+	addPath(option.ApiUri+"/links/:key", http.MethodGet, metadata)
+	addPath(option.ApiUri+"/links/:key/stats", http.MethodGet, stats)
+	addPath(option.ApiUri+"/inspect", http.MethodGet, inspect)
+
+	if option.AdminAuth != nil {
+		for _, prefix := range []string{option.ServiceUri + linkRoute, option.ApiUri + "/links"} {
+			addPath(prefix, http.MethodGet, list)
+			addPath(prefix+"/:key/detail", http.MethodGet, detail)
+			addPath(prefix+"/:key", http.MethodPut, update)
+			addPath(prefix+"/:key", http.MethodDelete, remove)
+			addPath(prefix+"/:key/disable", http.MethodPost, disable)
+			addPath(prefix+"/:key/enable", http.MethodPost, enable)
+		}
+	}
+
+	if option.OpenApiUri != "" {
+		addPath(option.OpenApiUri, http.MethodGet, object{
+			"summary": "OpenAPI文档",
+			"responses": object{
+				"200": object{"description": "OpenAPI 3文档"},
+			},
+		})
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "shorturl-service",
+			"version": "1.0.0",
+		},
+		"servers": []object{
+			{"url": "https://" + option.Domain},
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": openApiSchemas(),
+		},
+	}
+}
+
+func (option *Option) getOpenApiSpec(c *gin.Context) {
+	c.JSON(http.StatusOK, option.openApi)
+}
+
+// openApiPath 把gin的:param与*param转换为OpenAPI的{param}
+func openApiPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+var keyParam = object{
+	"name":     "key",
+	"in":       "path",
+	"required": true,
+	"schema":   object{"type": "string"},
+}
+
+func queryParam(name string, description string, required bool) object {
+	return object{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"required":    required,
+		"schema":      object{"type": "string"},
+	}
+}
+
+func schemaRef(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// requestBody 同时接受JSON与表单
+func requestBody(schema string, required bool) object {
+	return object{
+		"required": required,
+		"content": object{
+			"application/json":                  object{"schema": schemaRef(schema)},
+			"application/x-www-form-urlencoded": object{"schema": schemaRef(schema)},
+		},
+	}
+}
+
+// operation 返回JSON的接口，所有响应都是result
+func operation(summary string, parameters []object, body object, statuses ...int) object {
+	responses := object{}
+	for _, status := range statuses {
+		responses[strconv.Itoa(status)] = object{
+			"description": http.StatusText(status),
+			"content": object{
+				"application/json": object{"schema": schemaRef("Result")},
+			},
+		}
+	}
+
+	operation := object{
+		"summary":   summary,
+		"responses": responses,
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if body != nil {
+		operation["requestBody"] = body
+	}
+	return operation
+}
+
+func openApiSchemas() object {
+	stringType := object{"type": "string"}
+	stringMap := object{"type": "object", "additionalProperties": stringType}
+	dateTime := object{"type": "string", "format": "date-time"}
+	int64Type := object{"type": "integer", "format": "int64"}
+	passthrough := object{"type": "string", "enum": []string{
+		url_storage.PassthroughKeepTarget, url_storage.PassthroughOverride, url_storage.PassthroughAppend}}
+	redirectStatus := object{"type": "integer", "enum": []int{
+		http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}}
+
+	return object{
+		"Link": object{
+			"type": "object",
+			"properties": object{
+				"key":         stringType,
+				"long_url":    stringType,
+				"created_at":  dateTime,
+				"node_id":     int64Type,
+				"creator":     stringType,
+				"client_ip":   stringType,
+				"user_agent":  stringType,
+				"title":       stringType,
+				"description": stringType,
+				"tags":        object{"type": "array", "items": stringType},
+				"expire_at":   dateTime,
+				"disabled":    object{"type": "boolean"},
+
+				"redirect_status": redirectStatus,
+				"passthrough":     passthrough,
+			},
+		},
+		"Inspection": object{
+			"type": "object",
+			"properties": object{
+				"key":    stringType,
+				"exists": object{"type": "boolean"},
+				"state": object{
+					"type": "string",
+					"enum": []string{url_storage.StateActive, url_storage.StateExpired, url_storage.StateDisabled},
+				},
+			},
+		},
+		"Stats": object{
+			"type": "object",
+			"properties": object{
+				"key":      stringType,
+				"clicks":   int64Type,
+				"bots":     int64Type,
+				"visitors": int64Type,
+				"interval": object{"type": "string", "enum": []string{click_stats.IntervalHour, click_stats.IntervalDay}},
+				"series": object{"type": "array", "items": object{
+					"type": "object",
+					"properties": object{
+						"time":     dateTime,
+						"clicks":   int64Type,
+						"bots":     int64Type,
+						"visitors": int64Type,
+					},
+				}},
+			},
+		},
+		"Result": object{
+			"type":     "object",
+			"required": []string{"code", "message", "url"},
+			"properties": object{
+				"code":        object{"type": "integer"},
+				"message":     stringType,
+				"url":         stringType,
+				"error_code":  object{"type": "string", "enum": errorCodes},
+				"link":        schemaRef("Link"),
+				"errors":      stringMap,
+				"error_codes": stringMap,
+				"inspection":  schemaRef("Inspection"),
+				"links":       object{"type": "array", "items": schemaRef("Link")},
+				"cursor":      stringType,
+				"items":       object{"type": "array", "items": schemaRef("Result")},
+				"stats":       schemaRef("Stats"),
+			},
+		},
+		"CreateRequest": object{
+			"type":     "object",
+			"required": []string{"url"},
+			"properties": object{
+				"url":         stringType,
+				"alias":       stringType,
+				"title":       object{"type": "string", "maxLength": maxTitleLength},
+				"description": object{"type": "string", "maxLength": maxDescriptionLength},
+				"expire_at":   dateTime,
+				"expire_in":   object{"type": "string", "example": "72h"},
+				"tags":        object{"type": "array", "items": stringType, "maxItems": maxTags},
+
+				"redirect_status": redirectStatus,
+				"passthrough":     passthrough,
+			},
+		},
+		"UpdateRequest": object{
+			"type":     "object",
+			"required": []string{"url"},
+			"properties": object{
+				"url": stringType,
+			},
+		},
+	}
+}
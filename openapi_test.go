@@ -0,0 +1,105 @@
+package shorturl_service
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenApiSpec(t *testing.T) {
+	for _, serviceUri := range []string{"/", "/s/"} {
+		r := gin.Default()
+		option := &Option{
+			Domain:     "d.zhuyst.cc",
+			ServiceUri: serviceUri,
+			AdminAuth:  gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+			OpenApiUri: "/openapi.json",
+		}
+		err := InitRouter(r, nil, option)
+		if err != nil {
+			t.Errorf("InitRouter ERROR: %s", err.Error())
+			return
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("OpenApiSpec ERROR, expected 200, got %d", w.Code)
+			return
+		}
+
+		var spec struct {
+			OpenApi    string                                `json:"openapi"`
+			Paths      map[string]map[string]json.RawMessage `json:"paths"`
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]json.RawMessage `json:"properties"`
+				} `json:"schemas"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+			t.Errorf("OpenApiSpec ERROR: %s", err.Error())
+			return
+		}
+		if !strings.HasPrefix(spec.OpenApi, "3.") {
+			t.Errorf("OpenApiSpec ERROR, expected OpenAPI 3, got %s", spec.OpenApi)
+			return
+		}
+
+		// InitRouter注册的每个路由都要出现在文档中，dispatcher的通配符路由以其登记的路由代替
+		type route struct {
+			method string
+			path   string
+		}
+		var routes []route
+		for _, info := range r.Routes() {
+			if !strings.HasSuffix(info.Handler, "(*dispatcher).serve-fm") {
+				routes = append(routes, route{info.Method, info.Path})
+			}
+		}
+		for _, d := range option.dispatchers {
+			for _, dispatchRoute := range d.routes {
+				routes = append(routes, route{d.method, dispatchRoute.path})
+			}
+		}
+		for _, route := range routes {
+			path := openApiPath(route.path)
+			if _, ok := spec.Paths[path][strings.ToLower(route.method)]; !ok {
+				t.Errorf("OpenApiSpec ERROR, %s %s missing from spec", route.method, path)
+				return
+			}
+		}
+
+		// Result的字段与result保持一致
+		properties := spec.Components.Schemas["Result"].Properties
+		resultType := reflect.TypeOf(result{})
+		for i := 0; i < resultType.NumField(); i++ {
+			name := strings.Split(resultType.Field(i).Tag.Get("json"), ",")[0]
+			if _, ok := properties[name]; !ok {
+				t.Errorf("OpenApiSpec ERROR, result field %s missing from Result schema", name)
+				return
+			}
+		}
+	}
+
+	t.Logf("OpenApiSpec PASS")
+}
+
+func TestOpenApiSpecDisabledByDefault(t *testing.T) {
+	r := initTestRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("OpenApiSpecDisabledByDefault ERROR, expected 404, got %d", w.Code)
+		return
+	}
+
+	t.Logf("OpenApiSpecDisabledByDefault PASS")
+}
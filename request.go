@@ -0,0 +1,225 @@
+package shorturl_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zhuyst/shorturl-service/url-storage"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxTags      = 10
+	maxTagLength = 32
+
+	// 与SQL存储中title的VARCHAR(255)一致
+	maxTitleLength       = 255
+	maxDescriptionLength = 1024
+)
+
+// createRequest 创建短链接的参数，可以是表单也可以是JSON
+type createRequest struct {
+	Url         string   `form:"url" json:"url"`
+	Alias       string   `form:"alias" json:"alias"`
+	Title       string   `form:"title" json:"title"`
+	Description string   `form:"description" json:"description"`
+	ExpireAt    string   `form:"expire_at" json:"expire_at"`
+	ExpireIn    string   `form:"expire_in" json:"expire_in"`
+	Tags        []string `form:"tags" json:"tags"`
+
+	// 为0时使用Option.RedirectStatus
+	RedirectStatus int `form:"redirect_status" json:"redirect_status"`
+
+	// 为空时不透传多余的路径与查询参数
+	Passthrough string `form:"passthrough" json:"passthrough"`
+}
+
+// updateRequest 修改链接长URL的参数
+type updateRequest struct {
+	Url string `form:"url" json:"url"`
+}
+
+// validationError 按字段记录校验错误与错误码，Error()返回第一个错误
+type validationError struct {
+	first     string
+	firstCode string
+	Fields    map[string]string
+	Codes     map[string]string
+}
+
+func (e *validationError) Error() string {
+	return e.first
+}
+
+func (e *validationError) add(field string, code string, message string) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+		e.Codes = make(map[string]string)
+		e.first = message
+		e.firstCode = code
+	}
+	if _, exists := e.Fields[field]; !exists {
+		e.Fields[field] = message
+		e.Codes[field] = code
+	}
+}
+
+func (e *validationError) empty() bool {
+	return len(e.Fields) == 0
+}
+
+// bindCreateRequest 根据Content-Type解析表单或JSON请求体
+func bindCreateRequest(c *gin.Context) (*createRequest, *validationError) {
+	request := &createRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		verr := &validationError{}
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			verr.add(typeErr.Field, ErrorCodeInvalidBody,
+				fmt.Sprintf("%s need %s", typeErr.Field, typeErr.Type.String()))
+		} else {
+			verr.add("body", ErrorCodeInvalidBody, "invalid request body: "+err.Error())
+		}
+		return nil, verr
+	}
+	return request, nil
+}
+
+// newLink 校验参数并生成待保存的Link，所有字段的错误会一并返回
+func (option *Option) newLink(c *gin.Context, request *createRequest) (*url_storage.Link, *validationError) {
+	verr := &validationError{}
+
+	option.validateLongUrl(verr, request.Url)
+
+	if request.Alias != "" {
+		option.validateAlias(verr, request.Alias)
+	}
+
+	expireAt, field, err := option.parseExpireAt(request.ExpireAt, request.ExpireIn)
+	if err != nil {
+		verr.add(field, ErrorCodeInvalidExpiry, err.Error())
+	}
+
+	if utf8.RuneCountInString(request.Title) > maxTitleLength {
+		verr.add("title", ErrorCodeInvalidTitle, fmt.Sprintf("title can not be more than %d characters", maxTitleLength))
+	}
+	if utf8.RuneCountInString(request.Description) > maxDescriptionLength {
+		verr.add("description", ErrorCodeInvalidDescription,
+			fmt.Sprintf("description can not be more than %d characters", maxDescriptionLength))
+	}
+
+	if err := validateTags(request.Tags); err != nil {
+		verr.add("tags", ErrorCodeInvalidTags, err.Error())
+	}
+
+	if request.RedirectStatus != 0 && !validRedirectStatus(request.RedirectStatus) {
+		verr.add("redirect_status", ErrorCodeInvalidRedirectStatus, "redirect_status need 301, 302, 307 or 308")
+	}
+
+	switch request.Passthrough {
+	case "", url_storage.PassthroughKeepTarget, url_storage.PassthroughOverride, url_storage.PassthroughAppend:
+	default:
+		verr.add("passthrough", ErrorCodeInvalidPassthrough, fmt.Sprintf("passthrough need %s, %s or %s",
+			url_storage.PassthroughKeepTarget, url_storage.PassthroughOverride, url_storage.PassthroughAppend))
+	}
+
+	if !verr.empty() {
+		return nil, verr
+	}
+
+	return &url_storage.Link{
+		Key:         request.Alias,
+		LongUrl:     request.Url,
+		Creator:     option.CreatorFunc(c),
+		ClientIp:    c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Title:       request.Title,
+		Description: request.Description,
+		Tags:        request.Tags,
+		ExpireAt:    expireAt,
+
+		RedirectStatus: request.RedirectStatus,
+		Passthrough:    request.Passthrough,
+	}, nil
+}
+
+func (option *Option) validateLongUrl(verr *validationError, longUrl string) {
+	if longUrl == "" {
+		verr.add("url", ErrorCodeUrlRequired, "required url")
+	} else if !option.LongUrlRegexp.MatchString(longUrl) {
+		verr.add("url", ErrorCodeInvalidUrl, "need prefix with https://")
+	}
+}
+
+func (option *Option) validateAlias(verr *validationError, alias string) {
+	if !aliasRegexp.MatchString(alias) {
+		verr.add("alias", ErrorCodeInvalidAlias, "alias need 4-64 characters of 0-9, A-Z, a-z, _ or -")
+		return
+	}
+
+	for _, reserved := range option.ReservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			verr.add("alias", ErrorCodeAliasReserved, fmt.Sprintf("alias %s is reserved", alias))
+			return
+		}
+	}
+}
+
+func validRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("tags can not be more than %d", maxTags)
+	}
+
+	for _, tag := range tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return fmt.Errorf("tag need 1-%d characters", maxTagLength)
+		}
+	}
+	return nil
+}
+
+// parseExpireAt 过期时间可以是RFC3339格式的expire_at，或者time.ParseDuration格式的expire_in，
+// 都未指定时使用Option.DefaultTTL，出错时同时返回出错的字段名
+func (option *Option) parseExpireAt(expireAtValue string, expireInValue string) (*time.Time, string, error) {
+	now := time.Now()
+	var expireAt time.Time
+	field := "expire_at"
+	switch {
+	case expireAtValue != "" && expireInValue != "":
+		return nil, field, errors.New("expire_at and expire_in can not be used together")
+	case expireAtValue != "":
+		t, err := time.Parse(time.RFC3339, expireAtValue)
+		if err != nil {
+			return nil, field, errors.New("expire_at need RFC3339 format, e.g. 2019-04-01T00:00:00+08:00")
+		}
+		expireAt = t
+	case expireInValue != "":
+		field = "expire_in"
+		d, err := time.ParseDuration(expireInValue)
+		if err != nil || d <= 0 {
+			return nil, field, errors.New("expire_in need positive duration, e.g. 72h")
+		}
+		expireAt = now.Add(d)
+	case option.DefaultTTL > 0:
+		expireAt = now.Add(option.DefaultTTL)
+	default:
+		return nil, "", nil
+	}
+
+	if !expireAt.After(now) {
+		return nil, field, errors.New("expire_at must be in the future")
+	}
+	return &expireAt, "", nil
+}
@@ -0,0 +1,109 @@
+package shorturl_service
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// dispatcher 在一个通配符路由下按路径分发请求。
+// gin 1.3使用的httprouter不允许通配符与静态路径位于同一层，例如ServiceUri下的:key与meta、stats，
+// 这些静态路由不直接注册到gin，而是登记在dispatcher中，由prefix+":key"的处理函数匹配，
+// 都不匹配时交给fallback
+type dispatcher struct {
+	method   string
+	prefix   string
+	fallback gin.HandlerFunc
+
+	// 为true时同时注册prefix+":key/*path"，登记的路由可以有多段路径
+	catchAll bool
+
+	routes []*dispatchRoute
+}
+
+type dispatchRoute struct {
+	path     string
+	segments []string
+	handlers gin.HandlersChain
+}
+
+// handle 注册路由，path位于某个dispatcher的prefix下且第一段不是通配符时登记到该dispatcher，
+// 否则直接注册到router
+func (option *Option) handle(router gin.IRoutes, method string, path string, handlers ...gin.HandlerFunc) {
+	for _, d := range option.dispatchers {
+		if d.method != method || !strings.HasPrefix(path, d.prefix) {
+			continue
+		}
+
+		relativePath := strings.TrimPrefix(path, d.prefix)
+		if relativePath == "" || strings.HasPrefix(relativePath, ":") {
+			continue
+		}
+
+		segments := strings.Split(relativePath, "/")
+		if len(segments) > 1 && !d.catchAll {
+			continue
+		}
+		d.routes = append(d.routes, &dispatchRoute{
+			path:     path,
+			segments: segments,
+			handlers: handlers,
+		})
+		return
+	}
+
+	router.Handle(method, path, handlers...)
+}
+
+func (d *dispatcher) register(router gin.IRoutes) {
+	router.Handle(d.method, d.prefix+":key", d.serve)
+	if d.catchAll {
+		router.Handle(d.method, d.prefix+":key/*path", d.serve)
+	}
+}
+
+// serve 依次执行匹配路由的处理函数，鉴权等中间件Abort后不再继续
+func (d *dispatcher) serve(c *gin.Context) {
+	segments := strings.Split(c.Param("key")+c.Param("path"), "/")
+	for _, route := range d.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+
+		c.Params = params
+		for _, handler := range route.handlers {
+			handler(c)
+			if c.IsAborted() {
+				return
+			}
+		}
+		return
+	}
+
+	d.fallback(c)
+}
+
+func (route *dispatchRoute) match(segments []string) (gin.Params, bool) {
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+
+	var params gin.Params
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, ":") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params = append(params, gin.Param{Key: segment[1:], Value: segments[i]})
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// notFound 与gin未匹配到路由时的响应一致
+func notFound(c *gin.Context) {
+	c.String(http.StatusNotFound, "404 page not found")
+}
@@ -0,0 +1,59 @@
+package shorturl_service
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"testing"
+)
+
+func TestDispatcher(t *testing.T) {
+	for _, serviceUri := range []string{"/", "/s/"} {
+		r := gin.Default()
+		err := InitRouter(r, nil, &Option{
+			Domain:     "d.zhuyst.cc",
+			ServiceUri: serviceUri,
+			AdminAuth:  gin.BasicAuth(gin.Accounts{"admin": "secret"}),
+			OpenApiUri: "/openapi.json",
+		})
+		if err != nil {
+			t.Errorf("InitRouter ERROR: %s", err.Error())
+			return
+		}
+
+		code, _ := serveApi(r, http.MethodPost, "/api/v1/links", `{"url": "`+longUrl+`", "alias": "dispatch2026"}`)
+		if code != http.StatusOK {
+			t.Errorf("Dispatcher ERROR, expected 200, got %d", code)
+			return
+		}
+
+		testCases := []struct {
+			method string
+			path   string
+			auth   bool
+			code   int
+		}{
+			{http.MethodGet, serviceUri + "dispatch2026", false, http.StatusMovedPermanently},
+			{http.MethodGet, serviceUri + "meta/dispatch2026", false, http.StatusOK},
+			{http.MethodGet, serviceUri + "stats/dispatch2026", false, http.StatusOK},
+			{http.MethodGet, serviceUri + "meta", false, http.StatusNotFound},
+			{http.MethodGet, serviceUri + "link", false, http.StatusUnauthorized},
+			{http.MethodGet, serviceUri + "link", true, http.StatusOK},
+			{http.MethodGet, "/api/v1/links/dispatch2026/stats", false, http.StatusOK},
+			{http.MethodGet, "/api/v1/links", false, http.StatusUnauthorized},
+			{http.MethodGet, "/openapi.json", false, http.StatusOK},
+			{http.MethodPost, "/api/v1/links/batch", true, http.StatusBadRequest},
+			{http.MethodPost, "/api/v1/links/notexists", true, http.StatusNotFound},
+			{http.MethodPost, "/api/v1/links/dispatch2026/disable", false, http.StatusUnauthorized},
+		}
+		for _, testCase := range testCases {
+			w := serveLinkAdmin(r, testCase.method, testCase.path, testCase.auth)
+			if w.Code != testCase.code {
+				t.Errorf("Dispatcher %s %s ERROR, expected %d, got %d", testCase.method, testCase.path,
+					testCase.code, w.Code)
+				return
+			}
+		}
+	}
+
+	t.Logf("Dispatcher PASS")
+}
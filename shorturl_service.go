@@ -5,14 +5,58 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
+	"github.com/zhuyst/shorturl-service/bot-detector"
+	"github.com/zhuyst/shorturl-service/click-event"
+	"github.com/zhuyst/shorturl-service/click-stats"
+	"github.com/zhuyst/shorturl-service/key-generator"
 	"github.com/zhuyst/shorturl-service/logger"
 	"github.com/zhuyst/shorturl-service/url-storage"
+	"net/http"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	defaultLongUrlRegexp = regexp.MustCompile("https://.*")
 	defaultServiceUri    = "/"
+	defaultApiUri        = "/api/v1"
+
+	aliasRegexp = regexp.MustCompile("^[0-9A-Za-z_-]{4,64}$")
+)
+
+// ServiceUri下的固定路由，不能作为自定义别名
+const (
+	newRoute     = "new"
+	batchRoute   = "batch"
+	metaRoute    = "meta"
+	inspectRoute = "inspect"
+	linkRoute    = "link"
+	statsRoute   = "stats"
+)
+
+var reservedAliases = []string{newRoute, batchRoute, metaRoute, inspectRoute, linkRoute, statsRoute}
+
+const (
+	migrateBatch = 1000
+
+	defaultMaxBatchSize = 1000
+
+	defaultListCount = 100
+	maxListCount     = 1000
+
+	defaultCleanupInterval = 10 * time.Minute
+
+	// 过期的链接保留一段时间再清理，期间访问返回410而不是404
+	expiredRetention = 24 * time.Hour
+
+	// 等待写入的点击事件数量上限，超出后丢弃新的事件
+	clickEventBuffer = 1024
+
+	// 未指定范围时统计接口返回的时长
+	defaultHourlyRange = 24 * time.Hour
+	defaultDailyRange  = 7 * 24 * time.Hour
 )
 
 type Option struct {
@@ -20,23 +64,168 @@ type Option struct {
 	Domain        string
 	ServiceUri    string
 
+	// 提供OpenAPI 3文档的路径，例如/openapi.json，为空时不提供
+	OpenApiUri string
+
+	// 版本化REST接口的前缀，默认/api/v1，与ServiceUri重叠时其第一段路径会被保留为别名
+	ApiUri string
+
 	Logger logger.ILogger
 
-	urlStorage *url_storage.UrlStorage
+	// 从请求中识别创建者，记录在链接元数据中，默认取gin.BasicAuth设置的用户名
+	CreatorFunc func(c *gin.Context) string
+
+	// 未指定过期时间的链接的默认有效期，为0时永不过期
+	DefaultTTL time.Duration
+
+	// 清理过期链接的间隔，默认10分钟，Storage未实现url_storage.ExpiredDeleter时不清理
+	CleanupInterval time.Duration
+
+	// 相同的长URL复用已有的短URL，不会生成新的key，只对未设置过期时间的链接生效
+	Deduplicate bool
+
+	// 批量生成接口单次最多提交的URL数量，默认1000
+	MaxBatchSize int
+
+	// 管理接口（列出、修改、删除、禁用链接）的鉴权中间件，例如gin.BasicAuth，为空时不注册管理接口
+	AdminAuth gin.HandlerFunc
+
+	// 跳转默认使用的状态码，可选301、302、307或308，默认301，
+	// 301会被浏览器永久缓存，需要统计访问或修改长URL时建议使用302
+	RedirectStatus int
+
+	// 访问被禁用链接时的状态码，默认410
+	DisabledStatus int
+
+	// 访问被禁用链接时返回的HTML提示页，为空时返回纯文本
+	DisabledPage string
+
+	// 额外保留的别名，例如与ServiceUri下其他路由冲突的路径
+	ReservedAliases []string
+
+	// 自定义存储后端，为空时使用Redis Hash存储，redisClient也为空时使用内存存储
+	Storage url_storage.Storage
+
+	// 大于0时将映射分散到RedisBuckets个Hash中，并在后台迁移旧的单Hash数据
+	RedisBuckets uint32
+
+	// 自定义Key生成器，为空时通过Redis分配NodeId，redisClient也为空时使用NodeId 0
+	KeyGenerator *key_generator.KeyGenerator
+
+	// 点击事件的写入目标，每次跳转写入一条事件，写入在后台进行，不会阻塞跳转
+	ClickSink click_event.Sink
+
+	// ClickSink为空、redisClient不为空且大于0时，把点击事件写入Redis Stream，保留约ClickStreamMaxLen条
+	ClickStreamMaxLen int64
+
+	// 按小时与天统计点击数的存储，为空时使用Redis，redisClient也为空时使用内存存储
+	ClickStats click_stats.Storage
+
+	// 额外识别为爬虫的User-Agent片段，不区分大小写，与bot_detector.DefaultRules一起生效，
+	// 爬虫的访问不计入点击数与独立访客，单独统计
+	BotUserAgents []string
+
+	// 为true时爬虫不跳转，返回包含链接标题、描述与长URL的轻量页面，默认与普通访问一样跳转
+	BotMetadata bool
+
+	botDetector *bot_detector.BotDetector
+	urlStorage  *url_storage.UrlStorage
+	clickStats  *click_stats.ClickStats
+	clickEvents *click_event.AsyncSink
+	openApi     object
+	dispatchers []*dispatcher
+
+	cleanupTicker *time.Ticker
+	stopCleaner   chan struct{}
+	closeOnce     sync.Once
 }
 
-func InitRouter(router *gin.Engine, redisClient *redis.Client, option *Option) error {
+// InitRouter 注册短URL路由，redisClient可以是redis.Client、FailoverClient或ClusterClient，
+// 为nil时以纯进程内模式运行
+func InitRouter(router *gin.Engine, redisClient redis.UniversalClient, option *Option) error {
 	if err := option.initConfig(redisClient); err != nil {
 		return err
 	}
 
-	router.GET(fmt.Sprintf("%s:key", option.ServiceUri), option.redirectLongUrl)
-	router.POST(fmt.Sprintf("%snew", option.ServiceUri), option.generateShortUrl)
+	// ServiceUri下的GET路由与:key冲突，不匹配时按短URL跳转；
+	// ApiUri下的batch与管理接口的/links/:key冲突，不匹配时返回404
+	option.dispatchers = []*dispatcher{
+		{method: http.MethodGet, prefix: option.ServiceUri, fallback: option.redirectLongUrl, catchAll: true},
+		{method: http.MethodPost, prefix: option.ApiUri + "/links/", fallback: notFound},
+	}
+
+	option.handle(router, http.MethodPost, option.ServiceUri+newRoute, option.generateShortUrl)
+	option.handle(router, http.MethodPost, option.ServiceUri+batchRoute, option.batchGenerateShortUrl)
+	option.handle(router, http.MethodGet, fmt.Sprintf("%s%s/:key", option.ServiceUri, metaRoute), option.getLinkMetadata)
+	option.handle(router, http.MethodGet, option.ServiceUri+inspectRoute, option.inspectLink)
+	option.handle(router, http.MethodGet, fmt.Sprintf("%s%s/:key", option.ServiceUri, statsRoute), option.getLinkStats)
+
+	if option.AdminAuth != nil {
+		option.initAdminRouter(router, option.ServiceUri+linkRoute)
+	}
+
+	option.initApiRouter(router)
+
+	if option.OpenApiUri != "" {
+		option.openApi = option.openApiSpec()
+		option.handle(router, http.MethodGet, option.OpenApiUri, option.getOpenApiSpec)
+	}
 
+	for _, d := range option.dispatchers {
+		d.register(router)
+	}
 	return nil
 }
 
-func (option *Option) initConfig(redisClient *redis.Client) error {
+// initApiRouter 注册ApiUri下的版本化接口，与ServiceUri下的旧路由共用处理函数，
+// 新客户端应使用这组接口并根据error_code判断错误
+func (option *Option) initApiRouter(router *gin.Engine) {
+	option.handle(router, http.MethodPost, option.ApiUri+"/links", option.generateShortUrl)
+	option.handle(router, http.MethodPost, option.ApiUri+"/links/batch", option.batchGenerateShortUrl)
+	option.handle(router, http.MethodGet, option.ApiUri+"/links/:key", option.getLinkMetadata)
+	option.handle(router, http.MethodGet, option.ApiUri+"/links/:key/stats", option.getLinkStats)
+	option.handle(router, http.MethodGet, option.ApiUri+"/inspect", option.inspectLink)
+
+	if option.AdminAuth != nil {
+		option.initAdminRouter(router, option.ApiUri+"/links")
+	}
+}
+
+// initAdminRouter 注册prefix下的管理接口，每个接口都先经过AdminAuth
+func (option *Option) initAdminRouter(router *gin.Engine, prefix string) {
+	option.handle(router, http.MethodGet, prefix, option.AdminAuth, option.listLinks)
+	option.handle(router, http.MethodGet, prefix+"/:key/detail", option.AdminAuth, option.getLinkDetail)
+	option.handle(router, http.MethodPut, prefix+"/:key", option.AdminAuth, option.updateLink)
+	option.handle(router, http.MethodDelete, prefix+"/:key", option.AdminAuth, option.deleteLink)
+	option.handle(router, http.MethodPost, prefix+"/:key/disable", option.AdminAuth, option.disableLink)
+	option.handle(router, http.MethodPost, prefix+"/:key/enable", option.AdminAuth, option.enableLink)
+}
+
+// Close 停止后台任务，等待排队的点击事件写入，并写入尚未写入存储的点击数与统计，关闭服务前调用
+func (option *Option) Close() error {
+	option.closeOnce.Do(func() {
+		if option.cleanupTicker != nil {
+			option.cleanupTicker.Stop()
+			close(option.stopCleaner)
+		}
+	})
+
+	if option.clickEvents != nil {
+		option.clickEvents.Close()
+	}
+	if option.clickStats != nil {
+		if err := option.clickStats.Close(); err != nil {
+			logger.Error("ClickStats Flush FAIL, Error: %s", err.Error())
+		}
+	}
+
+	if option.urlStorage == nil {
+		return nil
+	}
+	return option.urlStorage.Close()
+}
+
+func (option *Option) initConfig(redisClient redis.UniversalClient) error {
 	if option.LongUrlRegexp == nil {
 		option.LongUrlRegexp = defaultLongUrlRegexp
 	}
@@ -45,20 +234,162 @@ func (option *Option) initConfig(redisClient *redis.Client) error {
 		option.ServiceUri = defaultServiceUri
 	}
 
+	if option.CleanupInterval <= 0 {
+		option.CleanupInterval = defaultCleanupInterval
+	}
+
+	if option.MaxBatchSize <= 0 {
+		option.MaxBatchSize = defaultMaxBatchSize
+	}
+
+	if option.RedirectStatus == 0 {
+		option.RedirectStatus = http.StatusMovedPermanently
+	}
+	if !validRedirectStatus(option.RedirectStatus) {
+		return fmt.Errorf("RedirectStatus need 301, 302, 307 or 308, got %d", option.RedirectStatus)
+	}
+
+	if option.DisabledStatus == 0 {
+		option.DisabledStatus = http.StatusGone
+	}
+
+	if option.CreatorFunc == nil {
+		option.CreatorFunc = defaultCreatorFunc
+	}
+
 	if option.Logger != nil {
 		logger.Logger = option.Logger
 	}
 
+	if option.ApiUri == "" {
+		option.ApiUri = defaultApiUri
+	}
+
+	option.ReservedAliases = append(option.ReservedAliases, reservedAliases...)
+	option.reserveRoute(option.ApiUri)
+	option.reserveRoute(option.OpenApiUri)
+
 	if option.Domain == "" {
 		return errors.New("need option.domain")
 	}
 
+	if redisClient != nil {
+		if err := redisClient.Ping().Err(); err != nil {
+			return err
+		}
+	}
+
+	if option.Storage == nil {
+		if redisClient != nil && option.RedisBuckets > 0 {
+			storage := url_storage.NewShardedRedisStorage(redisClient, option.RedisBuckets)
+			go migrateToBuckets(storage)
+			option.Storage = storage
+		} else if redisClient != nil {
+			option.Storage = url_storage.NewRedisStorage(redisClient)
+		} else {
+			option.Storage = url_storage.NewMemoryStorage()
+		}
+	}
+
+	if _, ok := option.Storage.(url_storage.Deduplicator); option.Deduplicate && !ok {
+		return errors.New("Deduplicate need option.Storage implementing url_storage.Deduplicator")
+	}
+
+	if option.KeyGenerator == nil {
+		var keyGenerator *key_generator.KeyGenerator
+		var err error
+		if redisClient != nil {
+			keyGenerator, err = key_generator.New(redisClient)
+		} else {
+			keyGenerator, err = key_generator.NewLocal(0)
+		}
+		if err != nil {
+			return err
+		}
+		option.KeyGenerator = keyGenerator
+	}
+
 	shortUrlPrefix := fmt.Sprintf("https://%s%s", option.Domain, option.ServiceUri)
-	urlStorage, err := url_storage.New(redisClient, shortUrlPrefix)
-	if err != nil {
-		return err
+	option.urlStorage = url_storage.NewWithStorage(option.Storage, option.KeyGenerator, shortUrlPrefix)
+	option.urlStorage.Deduplicate = option.Deduplicate
+
+	option.botDetector = bot_detector.New(option.BotUserAgents...)
+
+	if option.ClickStats == nil {
+		if redisClient != nil {
+			option.ClickStats = click_stats.NewRedisStorage(redisClient)
+		} else {
+			option.ClickStats = click_stats.NewMemoryStorage()
+		}
+	}
+	option.clickStats = click_stats.New(option.ClickStats)
+
+	if option.ClickSink == nil && redisClient != nil && option.ClickStreamMaxLen > 0 {
+		option.ClickSink = click_event.NewRedisStream(redisClient, option.ClickStreamMaxLen)
+	}
+	if option.ClickSink != nil {
+		option.clickEvents = click_event.NewAsyncSink(option.ClickSink, clickEventBuffer)
+	}
+
+	if _, ok := option.Storage.(url_storage.ExpiredDeleter); ok {
+		option.startExpiredCleaner()
 	}
-	option.urlStorage = urlStorage
 
 	return nil
 }
+
+// reserveRoute uri位于ServiceUri下时，保留其第一段路径，避免被自定义别名占用
+func (option *Option) reserveRoute(uri string) {
+	if uri == "" || !strings.HasPrefix(uri, option.ServiceUri) {
+		return
+	}
+
+	route := strings.SplitN(strings.TrimPrefix(uri, option.ServiceUri), "/", 2)[0]
+	if route != "" {
+		option.ReservedAliases = append(option.ReservedAliases, route)
+	}
+}
+
+func defaultCreatorFunc(c *gin.Context) string {
+	return c.GetString(gin.AuthUserKey)
+}
+
+func migrateToBuckets(storage *url_storage.RedisStorage) {
+	moved, err := storage.MigrateToBuckets(migrateBatch)
+	if err != nil {
+		logger.Error("MigrateToBuckets FAIL, moved: %d, Error: %s", moved, err.Error())
+		return
+	}
+
+	logger.Info("MigrateToBuckets SUCCESS, moved: %d", moved)
+}
+
+func (option *Option) startExpiredCleaner() {
+	ticker := time.NewTicker(option.CleanupInterval)
+	stop := make(chan struct{})
+	option.cleanupTicker = ticker
+	option.stopCleaner = stop
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				option.deleteExpired()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (option *Option) deleteExpired() {
+	deleted, err := option.urlStorage.DeleteExpired(time.Now().Add(-expiredRetention))
+	if err != nil {
+		logger.Error("DeleteExpired FAIL, Error: %s", err.Error())
+		return
+	}
+
+	if deleted > 0 {
+		logger.Info("DeleteExpired SUCCESS, deleted: %d", deleted)
+	}
+}
@@ -1,9 +1,16 @@
 package shorturl_service
 
 import (
+	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/zhuyst/shorturl-service/click-stats"
 	"github.com/zhuyst/shorturl-service/helper"
+	"github.com/zhuyst/shorturl-service/url-storage"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestInitRouter(t *testing.T) {
@@ -16,6 +23,9 @@ func initTestRouter(t *testing.T) *gin.Engine {
 	redisClient := helper.NewTestRedisClient()
 	err := InitRouter(r, redisClient, &Option{
 		Domain: "d.zhuyst.cc",
+
+		// miniredis不支持HyperLogLog
+		ClickStats: click_stats.NewMemoryStorage(),
 	})
 	if err != nil {
 		t.Fatalf("initRouter ERROR: %s", err.Error())
@@ -24,3 +34,206 @@ func initTestRouter(t *testing.T) *gin.Engine {
 
 	return r
 }
+
+// testStorage 包装内存存储，记录经过自定义存储保存的key
+type testStorage struct {
+	*url_storage.MemoryStorage
+	keys []string
+}
+
+func (storage *testStorage) SaveIfAbsent(link *url_storage.Link) error {
+	storage.keys = append(storage.keys, link.Key)
+	return storage.MemoryStorage.SaveIfAbsent(link)
+}
+
+func TestInitRouterWithStorage(t *testing.T) {
+	storage := &testStorage{MemoryStorage: url_storage.NewMemoryStorage()}
+
+	r := gin.Default()
+	if err := InitRouter(r, helper.NewTestRedisClient(), &Option{
+		Domain:  "d.zhuyst.cc",
+		Storage: storage,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	w := getGenerateShortUrlRecorder(r, longUrl)
+	if w.Code != http.StatusOK {
+		t.Errorf("InitRouterWithStorage ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	if len(storage.keys) != 1 {
+		t.Errorf("InitRouterWithStorage ERROR, expected 1 link, got %d", len(storage.keys))
+		return
+	}
+
+	testRedirectLongUrl(t, r, storage.keys[0])
+}
+
+func TestInitRouterInMemory(t *testing.T) {
+	r := gin.Default()
+	if err := InitRouter(r, nil, &Option{
+		Domain: "d.zhuyst.cc",
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	w := getGenerateShortUrlRecorder(r, longUrl)
+	if w.Code != http.StatusOK {
+		t.Errorf("InitRouterInMemory ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	var result result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Errorf("InitRouterInMemory jsonParseError: %s", err.Error())
+		return
+	}
+
+	testRedirectLongUrl(t, r, strings.TrimPrefix(result.Url, "https://d.zhuyst.cc/"))
+}
+
+func TestInitRouterWithBuckets(t *testing.T) {
+	r := gin.Default()
+	if err := InitRouter(r, helper.NewTestRedisClient(), &Option{
+		Domain:       "d.zhuyst.cc",
+		RedisBuckets: 16,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	w := getGenerateShortUrlRecorder(r, longUrl)
+	if w.Code != http.StatusOK {
+		t.Errorf("InitRouterWithBuckets ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	var result result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Errorf("InitRouterWithBuckets jsonParseError: %s", err.Error())
+		return
+	}
+
+	testRedirectLongUrl(t, r, strings.TrimPrefix(result.Url, "https://d.zhuyst.cc/"))
+}
+
+func TestInitRouterWithUniversalClient(t *testing.T) {
+	redisClient := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{helper.NewTestRedisClient().Options().Addr},
+	})
+
+	r := gin.Default()
+	if err := InitRouter(r, redisClient, &Option{
+		Domain: "d.zhuyst.cc",
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	w := getGenerateShortUrlRecorder(r, longUrl)
+	if w.Code != http.StatusOK {
+		t.Errorf("InitRouterWithUniversalClient ERROR, expected 200, got %d", w.Code)
+		return
+	}
+
+	t.Logf("InitRouterWithUniversalClient PASS")
+}
+
+func TestInitRouterWithDeduplicate(t *testing.T) {
+	r := gin.Default()
+	if err := InitRouter(r, helper.NewTestRedisClient(), &Option{
+		Domain:      "d.zhuyst.cc",
+		Deduplicate: true,
+	}); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	var shortUrls []string
+	for i := 0; i < 3; i++ {
+		var result result
+		w := getGenerateShortUrlRecorder(r, longUrl)
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Errorf("InitRouterWithDeduplicate jsonParseError: %s", err.Error())
+			return
+		}
+		shortUrls = append(shortUrls, result.Url)
+	}
+
+	if shortUrls[0] == "" || shortUrls[0] != shortUrls[1] || shortUrls[1] != shortUrls[2] {
+		t.Errorf("InitRouterWithDeduplicate ERROR, expected same short url, got %v", shortUrls)
+		return
+	}
+
+	testRedirectLongUrl(t, r, strings.TrimPrefix(shortUrls[0], "https://d.zhuyst.cc/"))
+}
+
+func TestOptionClose(t *testing.T) {
+	option := &Option{
+		Domain:          "d.zhuyst.cc",
+		CleanupInterval: time.Millisecond,
+	}
+	if err := InitRouter(gin.Default(), nil, option); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+
+	// 重复关闭不会panic
+	for i := 0; i < 2; i++ {
+		if err := option.Close(); err != nil {
+			t.Errorf("OptionClose ERROR: %s", err.Error())
+			return
+		}
+	}
+	select {
+	case <-option.stopCleaner:
+	default:
+		t.Errorf("OptionClose ERROR, expected cleaner stopped")
+		return
+	}
+
+	t.Logf("OptionClose PASS")
+}
+
+// minimalStorage 只实现url_storage.Storage，不实现任何可选接口
+type minimalStorage struct {
+	url_storage.Storage
+}
+
+func TestInitRouterDeduplicateNotSupported(t *testing.T) {
+	err := InitRouter(gin.Default(), nil, &Option{
+		Domain:      "d.zhuyst.cc",
+		Storage:     minimalStorage{url_storage.NewMemoryStorage()},
+		Deduplicate: true,
+	})
+	if err == nil {
+		t.Errorf("InitRouterDeduplicateNotSupported ERROR, expected error, got nil")
+		return
+	}
+
+	t.Logf("InitRouterDeduplicateNotSupported PASS, error: %s", err.Error())
+}
+
+func TestInitRouterCleanerNotSupported(t *testing.T) {
+	option := &Option{
+		Domain:          "d.zhuyst.cc",
+		Storage:         minimalStorage{url_storage.NewMemoryStorage()},
+		CleanupInterval: time.Millisecond,
+	}
+	if err := InitRouter(gin.Default(), nil, option); err != nil {
+		t.Fatalf("initRouter ERROR: %s", err.Error())
+		return
+	}
+	defer option.Close()
+
+	if option.cleanupTicker != nil {
+		t.Errorf("InitRouterCleanerNotSupported ERROR, expected cleaner not started")
+		return
+	}
+
+	t.Logf("InitRouterCleanerNotSupported PASS")
+}
@@ -0,0 +1,126 @@
+package url_storage
+
+import (
+	"github.com/zhuyst/shorturl-service/logger"
+	"sync"
+	"time"
+)
+
+const clickFlushInterval = time.Second
+
+// clickCounter 在内存中累加点击数并定期批量写入存储，跳转时只需加锁计数，
+// 写入失败的点击数保留到下一次写入，存储未实现ClickCounter时一直保留在内存中
+type clickCounter struct {
+	mutex   sync.Mutex
+	pending map[string]int64
+	storage ClickCounter
+
+	flushTicker *time.Ticker
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+func newClickCounter(storage Storage) *clickCounter {
+	clickStorage, _ := storage.(ClickCounter)
+	return &clickCounter{
+		pending: make(map[string]int64),
+		storage: clickStorage,
+		stop:    make(chan struct{}),
+	}
+}
+
+func (counter *clickCounter) incr(key string) {
+	counter.mutex.Lock()
+	counter.pending[key]++
+	counter.mutex.Unlock()
+}
+
+// drop 丢弃key尚未写入存储的点击数，链接被删除后不会再写入
+func (counter *clickCounter) drop(key string) {
+	counter.mutex.Lock()
+	delete(counter.pending, key)
+	counter.mutex.Unlock()
+}
+
+// get 返回尚未写入存储的点击数
+func (counter *clickCounter) get(key string) int64 {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	return counter.pending[key]
+}
+
+// flush 写入所有累加的点击数，返回遇到的第一个错误
+func (counter *clickCounter) flush() error {
+	if counter.storage == nil {
+		return nil
+	}
+
+	counter.mutex.Lock()
+	pending := counter.pending
+	counter.pending = make(map[string]int64)
+	counter.mutex.Unlock()
+
+	if batchStorage, ok := counter.storage.(BatchClickCounter); ok {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := batchStorage.IncrClicksBatch(pending); err != nil {
+			counter.mutex.Lock()
+			for key, n := range pending {
+				counter.pending[key] += n
+			}
+			counter.mutex.Unlock()
+			return err
+		}
+		return nil
+	}
+
+	var firstErr error
+	for key, n := range pending {
+		if err := counter.storage.IncrClicks(key, n); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			counter.mutex.Lock()
+			counter.pending[key] += n
+			counter.mutex.Unlock()
+		}
+	}
+	return firstErr
+}
+
+func (counter *clickCounter) start() {
+	if counter.storage == nil {
+		return
+	}
+
+	ticker := time.NewTicker(clickFlushInterval)
+	counter.flushTicker = ticker
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := counter.flush(); err != nil {
+					logger.Error("FlushClicks FAIL, Error: %s", err.Error())
+				}
+			case <-counter.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close 停止定期写入，并写入剩余的点击数
+func (counter *clickCounter) close() error {
+	counter.stopOnce.Do(func() {
+		if counter.flushTicker != nil {
+			counter.flushTicker.Stop()
+		}
+		close(counter.stop)
+	})
+
+	return counter.flush()
+}
@@ -0,0 +1,500 @@
+package url_storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/zhuyst/shorturl-service/logger"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	fileOpSet    = "set"
+	fileOpDelete = "del"
+	fileOpClicks = "clicks"
+)
+
+type fileRecord struct {
+	Op   string `json:"op"`
+	Key  string `json:"key"`
+	Link *Link  `json:"link,omitempty"`
+
+	// 通过SaveUnique保存，需要加入反向索引
+	Unique bool `json:"unique,omitempty"`
+
+	// 增加的点击数
+	Clicks int64 `json:"clicks,omitempty"`
+}
+
+// FileStorage 单机持久化存储，所有写操作追加到日志文件，
+// 启动时重放日志重建索引，并定期压缩掉被覆盖与删除的记录
+type FileStorage struct {
+	mutex sync.RWMutex
+	path  string
+	file  *os.File
+	links map[string]Link
+
+	// 通过SaveUnique保存的长URL到key的反向索引
+	longUrls map[string]string
+
+	clicks map[string]int64
+
+	// 日志中已失效的记录数，为0时无需压缩
+	garbage int
+
+	compactTicker *time.Ticker
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+// NewFileStorage 打开或创建日志文件，compactInterval <= 0 时不自动压缩
+func NewFileStorage(path string, compactInterval time.Duration) (*FileStorage, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &FileStorage{
+		path:     path,
+		file:     file,
+		links:    make(map[string]Link),
+		longUrls: make(map[string]string),
+		clicks:   make(map[string]int64),
+		stop:     make(chan struct{}),
+	}
+
+	if err := storage.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if compactInterval > 0 {
+		storage.startCompactor(compactInterval)
+	}
+
+	return storage, nil
+}
+
+// load 重放日志，末尾写了一半的记录（进程崩溃导致）会被截掉
+func (storage *FileStorage) load() error {
+	reader := bufio.NewReader(storage.file)
+
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				logger.Error("FileStorage load: drop incomplete record at offset %d", offset)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		storage.apply(&record)
+		offset += int64(len(line))
+	}
+
+	return storage.truncate(offset)
+}
+
+func (storage *FileStorage) apply(record *fileRecord) {
+	// 同一个key的多条点击数记录在压缩时合并为一条
+	if record.Op == fileOpClicks {
+		if _, ok := storage.links[record.Key]; ok {
+			if storage.clicks[record.Key] > 0 {
+				storage.garbage++
+			}
+			storage.clicks[record.Key] += record.Clicks
+		}
+		return
+	}
+
+	if link, ok := storage.links[record.Key]; ok {
+		storage.garbage++
+
+		// 删除或修改长URL时移除指向该key的反向索引
+		changed := record.Op == fileOpDelete || record.Link.LongUrl != link.LongUrl
+		if changed && storage.longUrls[link.LongUrl] == record.Key {
+			delete(storage.longUrls, link.LongUrl)
+		}
+	}
+
+	switch record.Op {
+	case fileOpSet:
+		storage.links[record.Key] = *record.Link
+		if record.Unique {
+			storage.longUrls[record.Link.LongUrl] = record.Key
+		}
+	case fileOpDelete:
+		delete(storage.links, record.Key)
+		delete(storage.clicks, record.Key)
+		storage.garbage++
+	}
+}
+
+func (storage *FileStorage) append(record *fileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	storage.apply(record)
+	return nil
+}
+
+// write 写入或Sync失败时截断到写入前的位置，避免写了一半的记录留在日志中间导致load失败
+func (storage *FileStorage) write(data []byte) error {
+	offset, err := storage.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.file.Write(data)
+	if err == nil {
+		err = storage.file.Sync()
+	}
+	if err != nil {
+		if truncateErr := storage.truncate(offset); truncateErr != nil {
+			logger.Error("FileStorage truncate FAIL, path: %s, offset: %d, Error: %s",
+				storage.path, offset, truncateErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func (storage *FileStorage) truncate(offset int64) error {
+	if err := storage.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := storage.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (storage *FileStorage) Save(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	return storage.append(&fileRecord{
+		Op:   fileOpSet,
+		Key:  link.Key,
+		Link: link,
+	})
+}
+
+func (storage *FileStorage) Update(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[link.Key]; !ok {
+		return ErrNotFound
+	}
+
+	return storage.append(&fileRecord{
+		Op:   fileOpSet,
+		Key:  link.Key,
+		Link: link,
+	})
+}
+
+func (storage *FileStorage) SaveIfAbsent(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[link.Key]; ok {
+		return ErrKeyExists
+	}
+
+	return storage.append(&fileRecord{
+		Op:   fileOpSet,
+		Key:  link.Key,
+		Link: link,
+	})
+}
+
+// SaveBatch 所有记录一次写入并Sync
+func (storage *FileStorage) SaveBatch(links []*Link) []error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	errs := make([]error, len(links))
+	records := make([]*fileRecord, 0, len(links))
+	claimed := make(map[string]bool, len(links))
+	var buffer bytes.Buffer
+	for i, link := range links {
+		if _, ok := storage.links[link.Key]; ok || claimed[link.Key] {
+			errs[i] = ErrKeyExists
+			continue
+		}
+
+		record := &fileRecord{
+			Op:   fileOpSet,
+			Key:  link.Key,
+			Link: link,
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+		claimed[link.Key] = true
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return errs
+	}
+	if err := storage.write(buffer.Bytes()); err != nil {
+		return fillErrors(errs, err)
+	}
+
+	for _, record := range records {
+		storage.apply(record)
+	}
+	return errs
+}
+
+func (storage *FileStorage) SaveUnique(link *Link) (*Link, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if key, ok := storage.longUrls[link.LongUrl]; ok {
+		existing := storage.links[key]
+		return &existing, nil
+	}
+
+	if _, ok := storage.links[link.Key]; ok {
+		return nil, ErrKeyExists
+	}
+
+	return link, storage.append(&fileRecord{
+		Op:     fileOpSet,
+		Key:    link.Key,
+		Link:   link,
+		Unique: true,
+	})
+}
+
+func (storage *FileStorage) Get(key string) (*Link, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	link, ok := storage.links[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &link, nil
+}
+
+func (storage *FileStorage) Delete(key string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[key]; !ok {
+		return ErrNotFound
+	}
+
+	return storage.append(&fileRecord{
+		Op:  fileOpDelete,
+		Key: key,
+	})
+}
+
+func (storage *FileStorage) Exists(key string) (bool, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	_, ok := storage.links[key]
+	return ok, nil
+}
+
+func (storage *FileStorage) DeleteExpired(before time.Time) (int64, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	var deleted int64
+	for key, link := range storage.links {
+		if !link.Expired(before) {
+			continue
+		}
+
+		if err := storage.append(&fileRecord{
+			Op:  fileOpDelete,
+			Key: key,
+		}); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Compact 将当前有效的映射写入新文件后替换旧日志
+func (storage *FileStorage) Compact() error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.garbage == 0 {
+		return nil
+	}
+
+	compactPath := storage.path + ".compact"
+	compactFile, err := os.OpenFile(compactPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(compactFile)
+	encoder := json.NewEncoder(writer)
+	for key := range storage.links {
+		link := storage.links[key]
+		if err := encoder.Encode(&fileRecord{
+			Op:     fileOpSet,
+			Key:    key,
+			Link:   &link,
+			Unique: storage.longUrls[link.LongUrl] == key,
+		}); err != nil {
+			compactFile.Close()
+			return err
+		}
+
+		if clicks := storage.clicks[key]; clicks > 0 {
+			if err := encoder.Encode(&fileRecord{
+				Op:     fileOpClicks,
+				Key:    key,
+				Clicks: clicks,
+			}); err != nil {
+				compactFile.Close()
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		compactFile.Close()
+		return err
+	}
+	if err := compactFile.Sync(); err != nil {
+		compactFile.Close()
+		return err
+	}
+
+	if err := os.Rename(compactPath, storage.path); err != nil {
+		compactFile.Close()
+		return err
+	}
+
+	storage.file.Close()
+	storage.file = compactFile
+	storage.garbage = 0
+
+	logger.Info("FileStorage Compact SUCCESS, path: %s, links: %d", storage.path, len(storage.links))
+	return nil
+}
+
+func (storage *FileStorage) startCompactor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	storage.compactTicker = ticker
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := storage.Compact(); err != nil {
+					logger.Error("FileStorage Compact FAIL, path: %s, Error: %s", storage.path, err.Error())
+				}
+			case <-storage.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (storage *FileStorage) Close() error {
+	storage.stopOnce.Do(func() {
+		if storage.compactTicker != nil {
+			storage.compactTicker.Stop()
+		}
+		close(storage.stop)
+	})
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	return storage.file.Close()
+}
+
+func (storage *FileStorage) IncrClicks(key string, n int64) error {
+	return storage.IncrClicksBatch(map[string]int64{key: n})
+}
+
+// IncrClicksBatch 所有点击数记录一次写入并Sync，不存在的key不计数
+func (storage *FileStorage) IncrClicksBatch(clicks map[string]int64) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	records := make([]*fileRecord, 0, len(clicks))
+	var buffer bytes.Buffer
+	for key, n := range clicks {
+		if _, ok := storage.links[key]; !ok {
+			continue
+		}
+
+		record := &fileRecord{
+			Op:     fileOpClicks,
+			Key:    key,
+			Clicks: n,
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := storage.write(buffer.Bytes()); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		storage.apply(record)
+	}
+	return nil
+}
+
+func (storage *FileStorage) Clicks(key string) (int64, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	return storage.clicks[key], nil
+}
+
+func (storage *FileStorage) Scan(cursor string, count int64) ([]*Link, string, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	links, nextCursor := scanLinks(storage.links, cursor, count)
+	return links, nextCursor, nil
+}
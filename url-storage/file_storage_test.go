@@ -0,0 +1,204 @@
+package url_storage
+
+import (
+	"bytes"
+	"github.com/zhuyst/shorturl-service/key-generator"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStorage(t *testing.T) {
+	storage, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	testStorage(t, storage)
+}
+
+func TestFileStorage_Reload(t *testing.T) {
+	storage, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	for _, link := range []*Link{
+		{Key: "a", LongUrl: "https://github.com/a"},
+		{Key: "b", LongUrl: "https://github.com/b"},
+		{Key: "a", LongUrl: "https://github.com/a2"},
+	} {
+		if err := storage.Save(link); err != nil {
+			t.Fatalf("FileStorage_Save ERROR: %s", err.Error())
+		}
+	}
+	if err := storage.Delete("b"); err != nil {
+		t.Fatalf("FileStorage_Delete ERROR: %s", err.Error())
+	}
+	for _, n := range []int64{2, 3} {
+		if err := storage.IncrClicks("a", n); err != nil {
+			t.Fatalf("FileStorage_IncrClicks ERROR: %s", err.Error())
+		}
+	}
+	storage.Close()
+
+	// 模拟写了一半的记录
+	file, _ := os.OpenFile(storage.path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"op":"set","key":"c"`)
+	file.Close()
+
+	reloaded, err := NewFileStorage(storage.path, 0)
+	if err != nil {
+		t.Fatalf("FileStorage_Reload ERROR: %s", err.Error())
+	}
+	defer reloaded.Close()
+
+	testFileStorageContent(t, reloaded)
+	if t.Failed() {
+		return
+	}
+
+	if err := reloaded.Compact(); err != nil {
+		t.Errorf("FileStorage_Compact ERROR: %s", err.Error())
+		return
+	}
+	if err := reloaded.Save(&Link{Key: "d", LongUrl: "https://github.com/d"}); err != nil {
+		t.Errorf("FileStorage_Save ERROR: %s", err.Error())
+		return
+	}
+	reloaded.Close()
+
+	compacted, err := NewFileStorage(storage.path, 0)
+	if err != nil {
+		t.Fatalf("FileStorage_Reload ERROR: %s", err.Error())
+	}
+	defer compacted.Close()
+
+	testFileStorageContent(t, compacted)
+	if compacted.garbage != 0 {
+		t.Errorf("FileStorage_Compact ERROR, expected 0 garbage, got %d", compacted.garbage)
+		return
+	}
+	if exists, _ := compacted.Exists("d"); !exists {
+		t.Errorf("FileStorage_Compact ERROR, expected d exists after compact, got false")
+		return
+	}
+
+	t.Logf("FileStorage_Reload PASS")
+}
+
+func testFileStorageContent(t *testing.T, storage *FileStorage) {
+	link, err := storage.Get("a")
+	if err != nil {
+		t.Errorf("FileStorage_Get ERROR: %s", err.Error())
+		return
+	}
+	if link.LongUrl != "https://github.com/a2" {
+		t.Errorf("FileStorage_Get ERROR, expected https://github.com/a2, got %s", link.LongUrl)
+		return
+	}
+	if clicks, _ := storage.Clicks("a"); clicks != 5 {
+		t.Errorf("FileStorage_Clicks ERROR, expected 5, got %d", clicks)
+		return
+	}
+
+	for _, key := range []string{"b", "c"} {
+		if exists, _ := storage.Exists(key); exists {
+			t.Errorf("FileStorage_Exists ERROR, expected %s not exists, got true", key)
+			return
+		}
+	}
+}
+
+func newFileStorage(t *testing.T) (*FileStorage, func()) {
+	dir, err := ioutil.TempDir("", "shorturl-service")
+	if err != nil {
+		t.Fatalf("TempDir ERROR: %s", err.Error())
+	}
+
+	storage, err := NewFileStorage(filepath.Join(dir, "links.log"), 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewFileStorage ERROR: %s", err.Error())
+	}
+
+	return storage, func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileStorage_ReloadSaveUnique(t *testing.T) {
+	storage, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	longUrl := "https://github.com/zhuyst/unique"
+	if _, err := storage.SaveUnique(&Link{Key: "unique1", LongUrl: longUrl}); err != nil {
+		t.Fatalf("FileStorage_SaveUnique ERROR: %s", err.Error())
+	}
+	storage.garbage++
+	if err := storage.Compact(); err != nil {
+		t.Fatalf("FileStorage_Compact ERROR: %s", err.Error())
+	}
+	storage.Close()
+
+	reloaded, err := NewFileStorage(storage.path, 0)
+	if err != nil {
+		t.Fatalf("FileStorage_Reload ERROR: %s", err.Error())
+	}
+	defer reloaded.Close()
+
+	link, err := reloaded.SaveUnique(&Link{Key: "unique2", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("FileStorage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+	if link.Key != "unique1" {
+		t.Errorf("FileStorage_ReloadSaveUnique ERROR, expected unique1, got %s", link.Key)
+		return
+	}
+
+	t.Logf("FileStorage_ReloadSaveUnique PASS")
+}
+
+func TestFileStorage_IncrClicksBatch(t *testing.T) {
+	storage, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Fatalf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+	}
+	urlStorage := NewWithStorage(storage, keyGenerator, "https://d.zhuyst.cc/")
+	defer urlStorage.Close()
+
+	for _, key := range []string{"a", "b"} {
+		if err := storage.Save(&Link{Key: key, LongUrl: "https://github.com/" + key}); err != nil {
+			t.Fatalf("FileStorage_Save ERROR: %s", err.Error())
+		}
+	}
+	urlStorage.RecordClick("a")
+	urlStorage.RecordClick("a")
+	urlStorage.RecordClick("b")
+	urlStorage.RecordClick("notexists")
+	if err := urlStorage.FlushClicks(); err != nil {
+		t.Errorf("UrlStorage_FlushClicks ERROR: %s", err.Error())
+		return
+	}
+
+	for key, expected := range map[string]int64{"a": 2, "b": 1, "notexists": 0} {
+		if clicks, _ := storage.Clicks(key); clicks != expected {
+			t.Errorf("FileStorage_IncrClicksBatch ERROR, expected %s clicks %d, got %d", key, expected, clicks)
+			return
+		}
+	}
+
+	// 两条保存记录与两条点击数记录，不存在的key不写入
+	data, err := ioutil.ReadFile(storage.path)
+	if err != nil {
+		t.Fatalf("ReadFile ERROR: %s", err.Error())
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 4 {
+		t.Errorf("FileStorage_IncrClicksBatch ERROR, expected 4 records, got %d", lines)
+		return
+	}
+
+	t.Logf("FileStorage_IncrClicksBatch PASS")
+}
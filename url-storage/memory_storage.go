@@ -0,0 +1,178 @@
+package url_storage
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStorage 进程内存储，用于嵌入式部署与单元测试，重启后数据丢失
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	links map[string]Link
+
+	// 通过SaveUnique保存的长URL到key的反向索引
+	longUrls map[string]string
+
+	clicks map[string]int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		links:    make(map[string]Link),
+		longUrls: make(map[string]string),
+		clicks:   make(map[string]int64),
+	}
+}
+
+func (storage *MemoryStorage) Save(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if existing, ok := storage.links[link.Key]; ok && existing.LongUrl != link.LongUrl {
+		storage.deleteLongUrlIndex(link.Key)
+	}
+	storage.links[link.Key] = *link
+	return nil
+}
+
+func (storage *MemoryStorage) Update(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	existing, ok := storage.links[link.Key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if existing.LongUrl != link.LongUrl {
+		storage.deleteLongUrlIndex(link.Key)
+	}
+	storage.links[link.Key] = *link
+	return nil
+}
+
+func (storage *MemoryStorage) SaveIfAbsent(link *Link) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[link.Key]; ok {
+		return ErrKeyExists
+	}
+
+	storage.links[link.Key] = *link
+	return nil
+}
+
+func (storage *MemoryStorage) SaveBatch(links []*Link) []error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	errs := make([]error, len(links))
+	for i, link := range links {
+		if _, ok := storage.links[link.Key]; ok {
+			errs[i] = ErrKeyExists
+			continue
+		}
+		storage.links[link.Key] = *link
+	}
+	return errs
+}
+
+func (storage *MemoryStorage) SaveUnique(link *Link) (*Link, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if key, ok := storage.longUrls[link.LongUrl]; ok {
+		existing := storage.links[key]
+		return &existing, nil
+	}
+
+	if _, ok := storage.links[link.Key]; ok {
+		return nil, ErrKeyExists
+	}
+
+	storage.links[link.Key] = *link
+	storage.longUrls[link.LongUrl] = link.Key
+	return link, nil
+}
+
+// deleteLongUrlIndex key被删除或修改长URL前移除指向它的反向索引
+func (storage *MemoryStorage) deleteLongUrlIndex(key string) {
+	link, ok := storage.links[key]
+	if ok && storage.longUrls[link.LongUrl] == key {
+		delete(storage.longUrls, link.LongUrl)
+	}
+}
+
+func (storage *MemoryStorage) Get(key string) (*Link, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	link, ok := storage.links[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &link, nil
+}
+
+func (storage *MemoryStorage) Delete(key string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[key]; !ok {
+		return ErrNotFound
+	}
+	storage.deleteLongUrlIndex(key)
+	delete(storage.links, key)
+	delete(storage.clicks, key)
+	return nil
+}
+
+func (storage *MemoryStorage) Exists(key string) (bool, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	_, ok := storage.links[key]
+	return ok, nil
+}
+
+func (storage *MemoryStorage) DeleteExpired(before time.Time) (int64, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	var deleted int64
+	for key, link := range storage.links {
+		if link.Expired(before) {
+			storage.deleteLongUrlIndex(key)
+			delete(storage.links, key)
+			delete(storage.clicks, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (storage *MemoryStorage) IncrClicks(key string, n int64) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.links[key]; ok {
+		storage.clicks[key] += n
+	}
+	return nil
+}
+
+func (storage *MemoryStorage) Clicks(key string) (int64, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	return storage.clicks[key], nil
+}
+
+func (storage *MemoryStorage) Scan(cursor string, count int64) ([]*Link, string, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	links, nextCursor := scanLinks(storage.links, cursor, count)
+	return links, nextCursor, nil
+}
@@ -0,0 +1,7 @@
+package url_storage
+
+import "testing"
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
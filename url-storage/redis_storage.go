@@ -0,0 +1,656 @@
+package url_storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	shortUrlKey = "SHORTURL_SERVICE:SHORT_URL"
+
+	// 分桶后的Hash为 SHORTURL_SERVICE:SHORT_URL:{bucket}
+	shortUrlBucketKeyPrefix = shortUrlKey
+
+	// Hash的field无法单独过期，用ZSet按过期时间索引有过期时间的key
+	expireAtKey = "SHORTURL_SERVICE:EXPIRE_AT"
+
+	// 长URL到链接的反向索引，用于去重，field为长URL的SHA1，分桶后同样分散到多个Hash，
+	// 开启分桶前的索引留在旧Hash中，分桶中没有时再查旧Hash
+	longUrlKey = "SHORTURL_SERVICE:LONG_URL"
+
+	// 点击数，field为key，分桶后同样分散到多个Hash，开启分桶前的点击数留在旧Hash中，读取时相加
+	clicksKey = "SHORTURL_SERVICE:CLICKS"
+
+	deleteExpiredBatch = 100
+	saveUniqueTries    = 3
+)
+
+// 反向索引仍指向该key时才删除
+var deleteLongUrlIndexScript = redis.NewScript(`
+	local value = redis.call("HGET", KEYS[1], ARGV[1])
+	if value and cjson.decode(value)["key"] == ARGV[2] then
+		return redis.call("HDEL", KEYS[1], ARGV[1])
+	end
+	return 0
+`)
+
+// key存在时才覆盖，返回是否覆盖
+var updateScript = redis.NewScript(`
+	if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+		redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+		return 1
+	end
+	return 0
+`)
+
+// RedisStorage 默认存储，所有映射保存在同一个Redis Hash中，值为JSON编码的Link，
+// 开启分桶后映射按key分散到多个Hash，旧的单Hash数据可通过MigrateToBuckets在线迁移
+type RedisStorage struct {
+	redisClient redis.UniversalClient
+	buckets     uint32
+}
+
+func NewRedisStorage(redisClient redis.UniversalClient) *RedisStorage {
+	return &RedisStorage{
+		redisClient: redisClient,
+	}
+}
+
+// NewShardedRedisStorage 将映射分散到buckets个Hash中，上线后不可再修改buckets
+func NewShardedRedisStorage(redisClient redis.UniversalClient, buckets uint32) *RedisStorage {
+	return &RedisStorage{
+		redisClient: redisClient,
+		buckets:     buckets,
+	}
+}
+
+func (storage *RedisStorage) sharded() bool {
+	return storage.buckets > 0
+}
+
+func (storage *RedisStorage) hashKey(key string) string {
+	return storage.bucketKey(shortUrlBucketKeyPrefix, key)
+}
+
+func (storage *RedisStorage) longUrlHashKey(field string) string {
+	return storage.bucketKey(longUrlKey, field)
+}
+
+func (storage *RedisStorage) bucketKey(prefix string, field string) string {
+	if !storage.sharded() {
+		return prefix
+	}
+
+	bucket := crc32.ChecksumIEEE([]byte(field)) % storage.buckets
+	return fmt.Sprintf("%s:%d", prefix, bucket)
+}
+
+func (storage *RedisStorage) Save(link *Link) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(storage.hashKey(link.Key), link.Key, value)
+		if link.ExpireAt != nil {
+			pipe.ZAdd(expireAtKey, redis.Z{
+				Score:  float64(link.ExpireAt.Unix()),
+				Member: link.Key,
+			})
+		} else {
+			pipe.ZRem(expireAtKey, link.Key)
+		}
+		return nil
+	})
+	return err
+}
+
+// Update 依次在分桶与旧Hash中覆盖。在旧Hash中覆盖后再覆盖一次分桶，
+// 避免期间被MigrateToBuckets移动到分桶的仍是旧值
+func (storage *RedisStorage) Update(link *Link) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	hashKey := storage.hashKey(link.Key)
+	updated, err := updateScript.Run(storage.redisClient, []string{hashKey}, link.Key, value).Int64()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 && storage.sharded() {
+		updated, err = updateScript.Run(storage.redisClient, []string{shortUrlKey}, link.Key, value).Int64()
+		if err != nil {
+			return err
+		}
+		if updated == 1 {
+			if err := updateScript.Run(storage.redisClient, []string{hashKey}, link.Key, value).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	if link.ExpireAt != nil {
+		return storage.redisClient.ZAdd(expireAtKey, redis.Z{
+			Score:  float64(link.ExpireAt.Unix()),
+			Member: link.Key,
+		}).Err()
+	}
+	return storage.redisClient.ZRem(expireAtKey, link.Key).Err()
+}
+
+// SaveBatch 用pipeline批量HSETNX，成功保存且设置了过期时间的再批量写入过期集合
+func (storage *RedisStorage) SaveBatch(links []*Link) []error {
+	errs := make([]error, len(links))
+	values := make([][]byte, len(links))
+	for i, link := range links {
+		value, err := json.Marshal(link)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		values[i] = value
+	}
+
+	// 未迁移的数据仍在旧Hash中
+	if storage.sharded() {
+		pipe := storage.redisClient.Pipeline()
+		cmds := make([]*redis.BoolCmd, len(links))
+		for i, link := range links {
+			if errs[i] == nil {
+				cmds[i] = pipe.HExists(shortUrlKey, link.Key)
+			}
+		}
+		pipe.Exec()
+		pipe.Close()
+
+		for i, cmd := range cmds {
+			if cmd == nil {
+				continue
+			}
+			exists, err := cmd.Result()
+			if err != nil {
+				errs[i] = err
+			} else if exists {
+				errs[i] = ErrKeyExists
+			}
+		}
+	}
+
+	pipe := storage.redisClient.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(links))
+	for i, link := range links {
+		if errs[i] == nil {
+			cmds[i] = pipe.HSetNX(storage.hashKey(link.Key), link.Key, values[i])
+		}
+	}
+	pipe.Exec()
+	pipe.Close()
+
+	expirePipe := storage.redisClient.Pipeline()
+	defer expirePipe.Close()
+	expireCmds := make([]*redis.IntCmd, len(links))
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		ok, err := cmd.Result()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if !ok {
+			errs[i] = ErrKeyExists
+			continue
+		}
+
+		if expireAt := links[i].ExpireAt; expireAt != nil {
+			expireCmds[i] = expirePipe.ZAdd(expireAtKey, redis.Z{
+				Score:  float64(expireAt.Unix()),
+				Member: links[i].Key,
+			})
+		}
+	}
+
+	expirePipe.Exec()
+	for i, cmd := range expireCmds {
+		if cmd != nil && cmd.Err() != nil {
+			errs[i] = cmd.Err()
+		}
+	}
+	return errs
+}
+
+// SaveUnique 先在反向索引中占位再写入映射，反向索引中保存完整的Link，
+// 其他节点读到占位但映射尚未写入时（写入方崩溃或仍在写入）会代为补全，因此同一个长URL只会有一个key
+func (storage *RedisStorage) SaveUnique(link *Link) (*Link, error) {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+
+	field := longUrlHash(link.LongUrl)
+	indexKey := storage.longUrlHashKey(field)
+	for i := 0; i < saveUniqueTries; i++ {
+		existingValue, err := storage.legacyLongUrlIndex(field)
+		if err != nil {
+			return nil, err
+		}
+
+		if existingValue == "" {
+			ok, err := storage.redisClient.HSetNX(indexKey, field, value).Result()
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if err := storage.SaveIfAbsent(link); err != nil {
+					if err == ErrKeyExists {
+						storage.deleteLongUrlIndex(link.LongUrl, link.Key)
+					}
+					return nil, err
+				}
+				return link, nil
+			}
+
+			existingValue, err = storage.redisClient.HGet(indexKey, field).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		existing, err := decodeLink("", existingValue)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := storage.Get(existing.Key)
+		if err == ErrNotFound {
+			if err := storage.redisClient.HSetNX(storage.hashKey(existing.Key), existing.Key,
+				existingValue).Err(); err != nil {
+				return nil, err
+			}
+			return existing, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if current.LongUrl == link.LongUrl {
+			return current, nil
+		}
+
+		// 已有的key被修改为其他长URL，反向索引失效
+		if err := storage.deleteLongUrlIndex(existing.LongUrl, existing.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("url_storage: SaveUnique conflict after %d tries", saveUniqueTries)
+}
+
+// legacyLongUrlIndex 开启分桶前的反向索引仍在旧Hash中，不存在或未开启分桶时返回空字符串
+func (storage *RedisStorage) legacyLongUrlIndex(field string) (string, error) {
+	if !storage.sharded() {
+		return "", nil
+	}
+
+	value, err := storage.redisClient.HGet(longUrlKey, field).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (storage *RedisStorage) deleteLongUrlIndex(longUrl string, key string) error {
+	field := longUrlHash(longUrl)
+	if storage.sharded() {
+		if err := deleteLongUrlIndexScript.Run(storage.redisClient,
+			[]string{longUrlKey}, field, key).Err(); err != nil {
+			return err
+		}
+	}
+	return deleteLongUrlIndexScript.Run(storage.redisClient,
+		[]string{storage.longUrlHashKey(field)}, field, key).Err()
+}
+
+func (storage *RedisStorage) SaveIfAbsent(link *Link) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	// 未迁移的数据仍在旧Hash中
+	if storage.sharded() {
+		exists, err := storage.redisClient.HExists(shortUrlKey, link.Key).Result()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrKeyExists
+		}
+	}
+
+	ok, err := storage.redisClient.HSetNX(storage.hashKey(link.Key), link.Key, value).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyExists
+	}
+
+	if link.ExpireAt != nil {
+		return storage.redisClient.ZAdd(expireAtKey, redis.Z{
+			Score:  float64(link.ExpireAt.Unix()),
+			Member: link.Key,
+		}).Err()
+	}
+	return nil
+}
+
+func (storage *RedisStorage) Get(key string) (*Link, error) {
+	value, err := storage.get(key)
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeLink(key, value)
+}
+
+// decodeLink 兼容旧版本直接保存长URL的值
+func decodeLink(key string, value string) (*Link, error) {
+	if !strings.HasPrefix(value, "{") {
+		return &Link{
+			Key:     key,
+			LongUrl: value,
+		}, nil
+	}
+
+	link := &Link{}
+	if err := json.Unmarshal([]byte(value), link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+func (storage *RedisStorage) get(key string) (string, error) {
+	hashKey := storage.hashKey(key)
+	value, err := storage.redisClient.HGet(hashKey, key).Result()
+	if err != redis.Nil || !storage.sharded() {
+		return value, err
+	}
+
+	// 未迁移的数据仍在旧Hash中
+	value, err = storage.redisClient.HGet(shortUrlKey, key).Result()
+	if err != redis.Nil {
+		return value, err
+	}
+
+	// 读取两个Hash之间恰好被迁移走，再读一次分桶
+	return storage.redisClient.HGet(hashKey, key).Result()
+}
+
+func (storage *RedisStorage) Delete(key string) error {
+	link, err := storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.deleteLongUrlIndex(link.LongUrl, key); err != nil {
+		return err
+	}
+
+	var deleted int64
+	if storage.sharded() {
+		n, err := storage.redisClient.HDel(shortUrlKey, key).Result()
+		if err != nil {
+			return err
+		}
+		deleted += n
+	}
+
+	n, err := storage.redisClient.HDel(storage.hashKey(key), key).Result()
+	if err != nil {
+		return err
+	}
+	deleted += n
+
+	if err := storage.redisClient.ZRem(expireAtKey, key).Err(); err != nil {
+		return err
+	}
+	if err := storage.redisClient.HDel(storage.bucketKey(clicksKey, key), key).Err(); err != nil {
+		return err
+	}
+	if storage.sharded() {
+		if err := storage.redisClient.HDel(clicksKey, key).Err(); err != nil {
+			return err
+		}
+	}
+
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (storage *RedisStorage) Exists(key string) (bool, error) {
+	exists, err := storage.redisClient.HExists(storage.hashKey(key), key).Result()
+	if err != nil || exists || !storage.sharded() {
+		return exists, err
+	}
+
+	return storage.redisClient.HExists(shortUrlKey, key).Result()
+}
+
+func (storage *RedisStorage) DeleteExpired(before time.Time) (int64, error) {
+	var deleted int64
+	var offset int64
+	for {
+		keys, err := storage.redisClient.ZRangeByScore(expireAtKey, redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    strconv.FormatInt(before.Unix(), 10),
+			Offset: offset,
+			Count:  deleteExpiredBatch,
+		}).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+
+		for _, key := range keys {
+			linkDeleted, indexRemoved, err := storage.deleteIfExpired(key, before)
+			if err != nil {
+				return deleted, err
+			}
+
+			if linkDeleted {
+				deleted++
+			}
+			// 仍留在索引中的key下一批跳过
+			if !indexRemoved {
+				offset++
+			}
+		}
+	}
+}
+
+// deleteIfExpired 删除前再次确认，索引与映射之间可能已被更新
+func (storage *RedisStorage) deleteIfExpired(key string, before time.Time) (bool, bool, error) {
+	link, err := storage.Get(key)
+	if err == ErrNotFound {
+		return false, true, storage.redisClient.ZRem(expireAtKey, key).Err()
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	if link.Expired(before) {
+		if err := storage.Delete(key); err != nil && err != ErrNotFound {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	// 过期时间已被取消或延长，修正索引
+	if link.ExpireAt == nil {
+		return false, true, storage.redisClient.ZRem(expireAtKey, key).Err()
+	}
+	score := link.ExpireAt.Unix()
+	return false, score > before.Unix(), storage.redisClient.ZAdd(expireAtKey, redis.Z{
+		Score:  float64(score),
+		Member: key,
+	}).Err()
+}
+
+// IncrClicks 先计数再检查链接是否存在，不存在时删除计数，避免已删除或被重新占用的key继承点击数。
+// 链接与点击数不在同一个Key中，为了在集群中可用不使用多Key的脚本；
+// 检查前链接被删除时，Delete会在之后删除点击数
+func (storage *RedisStorage) IncrClicks(key string, n int64) error {
+	hashKey := storage.bucketKey(clicksKey, key)
+	if err := storage.redisClient.HIncrBy(hashKey, key, n).Err(); err != nil {
+		return err
+	}
+
+	_, err := storage.get(key)
+	if err == redis.Nil {
+		return storage.redisClient.HDel(hashKey, key).Err()
+	}
+	return err
+}
+
+// Clicks 开启分桶前的点击数仍在旧Hash中，与分桶中的点击数相加
+func (storage *RedisStorage) Clicks(key string) (int64, error) {
+	hashKeys := []string{storage.bucketKey(clicksKey, key)}
+	if storage.sharded() {
+		hashKeys = append(hashKeys, clicksKey)
+	}
+
+	var clicks int64
+	for _, hashKey := range hashKeys {
+		n, err := storage.redisClient.HGet(hashKey, key).Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		clicks += n
+	}
+	return clicks, nil
+}
+
+// Scan 依次HSCAN旧Hash与各个分桶，游标格式为"Hash序号:HSCAN游标"，
+// 迁移过程中同一个key可能被返回两次
+func (storage *RedisStorage) Scan(cursor string, count int64) ([]*Link, string, error) {
+	hashKeys := storage.scanHashKeys()
+
+	var index int
+	var hashCursor uint64
+	if cursor != "" {
+		if _, err := fmt.Sscanf(cursor, "%d:%d", &index, &hashCursor); err != nil ||
+			index < 0 || index >= len(hashKeys) {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	fields, nextCursor, err := storage.redisClient.HScan(hashKeys[index], hashCursor, "", count).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	links := make([]*Link, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		link, err := decodeLink(fields[i], fields[i+1])
+		if err != nil {
+			return nil, "", err
+		}
+		links = append(links, link)
+	}
+
+	if nextCursor == 0 {
+		index++
+		if index == len(hashKeys) {
+			return links, "", nil
+		}
+	}
+	return links, fmt.Sprintf("%d:%d", index, nextCursor), nil
+}
+
+func (storage *RedisStorage) scanHashKeys() []string {
+	hashKeys := []string{shortUrlKey}
+	for i := uint32(0); i < storage.buckets; i++ {
+		hashKeys = append(hashKeys, fmt.Sprintf("%s:%d", shortUrlBucketKeyPrefix, i))
+	}
+	return hashKeys
+}
+
+// MigrateToBuckets 将旧的单Hash中的映射分批移动到分桶中，迁移期间读写不受影响，
+// 可重复执行，也可多个节点同时执行，返回本次移动的映射数
+func (storage *RedisStorage) MigrateToBuckets(batch int64) (int, error) {
+	if !storage.sharded() {
+		return 0, fmt.Errorf("url_storage: buckets not enabled")
+	}
+
+	var moved int
+	var cursor uint64
+	for {
+		fields, nextCursor, err := storage.redisClient.HScan(shortUrlKey, cursor, "", batch).Result()
+		if err != nil {
+			return moved, err
+		}
+
+		for i := 0; i+1 < len(fields); i += 2 {
+			ok, err := storage.moveToBucket(fields[i], fields[i+1])
+			if err != nil {
+				return moved, err
+			}
+			if ok {
+				moved++
+			}
+		}
+
+		if nextCursor == 0 {
+			return moved, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func (storage *RedisStorage) moveToBucket(key string, value string) (bool, error) {
+	hashKey := storage.hashKey(key)
+
+	// 分桶中已有的值更新，不覆盖
+	set, err := storage.redisClient.HSetNX(hashKey, key, value).Result()
+	if err != nil {
+		return false, err
+	}
+
+	n, err := storage.redisClient.HDel(shortUrlKey, key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	// 旧Hash中的映射在迁移途中被删除，撤销刚写入的分桶
+	if n == 0 && set {
+		return false, storage.redisClient.HDel(hashKey, key).Err()
+	}
+
+	return set, nil
+}
@@ -0,0 +1,693 @@
+package url_storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zhuyst/shorturl-service/helper"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisStorage(t *testing.T) {
+	testStorage(t, NewRedisStorage(helper.NewTestRedisClient()))
+}
+
+func TestRedisStorage_LegacyValue(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	longUrl := "https://github.com/zhuyst"
+	redisClient.HSet(shortUrlKey, "4dUaeq5", longUrl)
+
+	link, err := NewRedisStorage(redisClient).Get("4dUaeq5")
+	if err != nil {
+		t.Errorf("RedisStorage_LegacyValue ERROR: %s", err.Error())
+		return
+	}
+	if link.LongUrl != longUrl {
+		t.Errorf("RedisStorage_LegacyValue ERROR, expected %s, got %s", longUrl, link.LongUrl)
+		return
+	}
+
+	t.Logf("RedisStorage_LegacyValue PASS")
+}
+
+// builtinStorage 内置存储都实现的接口
+type builtinStorage interface {
+	Storage
+	Deduplicator
+	Scanner
+	ExpiredDeleter
+}
+
+func testStorage(t *testing.T, storage builtinStorage) {
+	link := &Link{
+		Key:       "4dUaeq5",
+		LongUrl:   "https://github.com/zhuyst",
+		CreatedAt: time.Now().Truncate(time.Second),
+		NodeId:    3,
+		Creator:   "zhuyst",
+		ClientIp:  "127.0.0.1",
+		UserAgent: "curl/7.64.0",
+		Title:     "shorturl-service",
+		Tags:      []string{"github", "profile"},
+	}
+	if err := storage.Save(link); err != nil {
+		t.Errorf("Storage_Save ERROR: %s", err.Error())
+		return
+	}
+
+	exists, err := storage.Exists(link.Key)
+	if err != nil {
+		t.Errorf("Storage_Exists ERROR: %s", err.Error())
+		return
+	}
+	if !exists {
+		t.Errorf("Storage_Exists ERROR, expected true, got false")
+		return
+	}
+
+	linkFromStorage, err := storage.Get(link.Key)
+	if err != nil {
+		t.Errorf("Storage_Get ERROR: %s", err.Error())
+		return
+	}
+	if linkFromStorage.LongUrl != link.LongUrl {
+		t.Errorf("Storage_Get ERROR, expected %s, got %s", link.LongUrl, linkFromStorage.LongUrl)
+		return
+	}
+	if linkFromStorage.NodeId != link.NodeId || linkFromStorage.Creator != link.Creator ||
+		linkFromStorage.ClientIp != link.ClientIp || linkFromStorage.UserAgent != link.UserAgent ||
+		linkFromStorage.Title != link.Title || !linkFromStorage.CreatedAt.Equal(link.CreatedAt) ||
+		strings.Join(linkFromStorage.Tags, ",") != strings.Join(link.Tags, ",") {
+		t.Errorf("Storage_Get ERROR, expected metadata %+v, got %+v", link, linkFromStorage)
+		return
+	}
+
+	if err := storage.Delete(link.Key); err != nil {
+		t.Errorf("Storage_Delete ERROR: %s", err.Error())
+		return
+	}
+
+	if _, err := storage.Get(link.Key); err != ErrNotFound {
+		t.Errorf("Storage_Get ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+
+	if err := storage.Delete(link.Key); err != ErrNotFound {
+		t.Errorf("Storage_Delete ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+
+	testStorageDeleteExpired(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageSaveUnique(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageSaveIfAbsent(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageSaveBatch(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageScan(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageClicks(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	testStorageUpdate(t, storage)
+	if t.Failed() {
+		return
+	}
+
+	t.Logf("Storage PASS")
+}
+
+func testStorageDeleteExpired(t *testing.T, storage builtinStorage) {
+	now := time.Now().Truncate(time.Second)
+	expired := now.Add(-time.Hour)
+	notExpired := now.Add(time.Hour)
+
+	for _, link := range []*Link{
+		{Key: "expired", LongUrl: "https://github.com/expired", ExpireAt: &expired},
+		{Key: "notExpired", LongUrl: "https://github.com/notExpired", ExpireAt: &notExpired},
+		{Key: "forever", LongUrl: "https://github.com/forever"},
+	} {
+		if err := storage.Save(link); err != nil {
+			t.Errorf("Storage_Save ERROR: %s", err.Error())
+			return
+		}
+	}
+
+	link, err := storage.Get("expired")
+	if err != nil {
+		t.Errorf("Storage_Get ERROR: %s", err.Error())
+		return
+	}
+	if !link.Expired(now) || link.ExpireAt == nil || !link.ExpireAt.Equal(expired) {
+		t.Errorf("Storage_Get ERROR, expected expire at %s, got %v", expired, link.ExpireAt)
+		return
+	}
+
+	deleted, err := storage.DeleteExpired(now)
+	if err != nil {
+		t.Errorf("Storage_DeleteExpired ERROR: %s", err.Error())
+		return
+	}
+	if deleted != 1 {
+		t.Errorf("Storage_DeleteExpired ERROR, expected 1 deleted, got %d", deleted)
+		return
+	}
+
+	for key, expected := range map[string]bool{"expired": false, "notExpired": true, "forever": true} {
+		exists, err := storage.Exists(key)
+		if err != nil {
+			t.Errorf("Storage_Exists ERROR: %s", err.Error())
+			return
+		}
+		if exists != expected {
+			t.Errorf("Storage_DeleteExpired ERROR, expected %s exists %t, got %t", key, expected, exists)
+			return
+		}
+	}
+
+	storage.Delete("notExpired")
+	storage.Delete("forever")
+}
+
+func TestShardedRedisStorage(t *testing.T) {
+	testStorage(t, NewShardedRedisStorage(helper.NewTestRedisClient(), 16))
+}
+
+func TestRedisStorage_ScanInvalidCursor(t *testing.T) {
+	storage := NewShardedRedisStorage(helper.NewTestRedisClient(), 4)
+	for _, cursor := range []string{"abc", "5:0", "-1:0"} {
+		if _, _, err := storage.Scan(cursor, 10); err != ErrInvalidCursor {
+			t.Errorf("RedisStorage_Scan %s ERROR, expected ErrInvalidCursor, got %v", cursor, err)
+			return
+		}
+	}
+
+	t.Logf("RedisStorage_ScanInvalidCursor PASS")
+}
+
+func TestRedisStorage_MigrateToBuckets(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	legacyStorage := NewRedisStorage(redisClient)
+
+	linkNumber := 100
+	for i := 0; i < linkNumber; i++ {
+		if err := legacyStorage.Save(&Link{
+			Key:     fmt.Sprintf("key%d", i),
+			LongUrl: fmt.Sprintf("https://github.com/%d", i),
+		}); err != nil {
+			t.Fatalf("RedisStorage_Save ERROR: %s", err.Error())
+		}
+	}
+
+	storage := NewShardedRedisStorage(redisClient, 16)
+
+	// 迁移前通过旧Hash读取
+	link, err := storage.Get("key0")
+	if err != nil {
+		t.Errorf("RedisStorage_Get before migrate ERROR: %s", err.Error())
+		return
+	}
+	if link.LongUrl != "https://github.com/0" {
+		t.Errorf("RedisStorage_Get before migrate ERROR, expected https://github.com/0, got %s", link.LongUrl)
+		return
+	}
+
+	// 迁移前新写入的值不应被旧值覆盖
+	if err := storage.Save(&Link{Key: "key1", LongUrl: "https://github.com/new"}); err != nil {
+		t.Fatalf("RedisStorage_Save ERROR: %s", err.Error())
+	}
+
+	// 迁移前修改仍在旧Hash中的映射
+	if err := storage.Update(&Link{Key: "key2", LongUrl: "https://github.com/updated"}); err != nil {
+		t.Fatalf("RedisStorage_Update ERROR: %s", err.Error())
+	}
+
+	moved, err := storage.MigrateToBuckets(10)
+	if err != nil {
+		t.Errorf("RedisStorage_MigrateToBuckets ERROR: %s", err.Error())
+		return
+	}
+	if moved != linkNumber-1 {
+		t.Errorf("RedisStorage_MigrateToBuckets ERROR, expected moved %d, got %d", linkNumber-1, moved)
+		return
+	}
+
+	if n := redisClient.HLen(shortUrlKey).Val(); n != 0 {
+		t.Errorf("RedisStorage_MigrateToBuckets ERROR, expected empty legacy hash, got %d", n)
+		return
+	}
+
+	for i := 0; i < linkNumber; i++ {
+		expected := fmt.Sprintf("https://github.com/%d", i)
+		if i == 1 {
+			expected = "https://github.com/new"
+		}
+		if i == 2 {
+			expected = "https://github.com/updated"
+		}
+
+		link, err := storage.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Errorf("RedisStorage_Get after migrate ERROR: %s", err.Error())
+			return
+		}
+		if link.LongUrl != expected {
+			t.Errorf("RedisStorage_Get after migrate ERROR, expected %s, got %s", expected, link.LongUrl)
+			return
+		}
+	}
+
+	t.Logf("RedisStorage_MigrateToBuckets PASS, moved: %d", moved)
+}
+
+func testStorageSaveUnique(t *testing.T, storage builtinStorage) {
+	longUrl := "https://github.com/zhuyst/unique"
+	first, err := storage.SaveUnique(&Link{Key: "unique1", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("Storage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+
+	second, err := storage.SaveUnique(&Link{Key: "unique2", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("Storage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+	if first.Key != "unique1" || second.Key != "unique1" {
+		t.Errorf("Storage_SaveUnique ERROR, expected unique1, got %s and %s", first.Key, second.Key)
+		return
+	}
+	if exists, _ := storage.Exists("unique2"); exists {
+		t.Errorf("Storage_SaveUnique ERROR, expected unique2 not saved, got exists")
+		return
+	}
+
+	// 修改长URL后反向索引失效
+	if err := storage.Save(&Link{Key: "unique1", LongUrl: "https://github.com/zhuyst/other"}); err != nil {
+		t.Errorf("Storage_Save ERROR: %s", err.Error())
+		return
+	}
+	third, err := storage.SaveUnique(&Link{Key: "unique3", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("Storage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+	if third.Key != "unique3" {
+		t.Errorf("Storage_SaveUnique ERROR, expected unique3 after update, got %s", third.Key)
+		return
+	}
+
+	// 删除后可以重新生成
+	if err := storage.Delete("unique3"); err != nil {
+		t.Errorf("Storage_Delete ERROR: %s", err.Error())
+		return
+	}
+	fourth, err := storage.SaveUnique(&Link{Key: "unique4", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("Storage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+	if fourth.Key != "unique4" {
+		t.Errorf("Storage_SaveUnique ERROR, expected unique4 after delete, got %s", fourth.Key)
+		return
+	}
+
+	storage.Delete("unique1")
+	storage.Delete("unique4")
+}
+
+func testStorageSaveIfAbsent(t *testing.T, storage builtinStorage) {
+	link := &Link{Key: "launch2026", LongUrl: "https://github.com/zhuyst/launch"}
+	if err := storage.SaveIfAbsent(link); err != nil {
+		t.Errorf("Storage_SaveIfAbsent ERROR: %s", err.Error())
+		return
+	}
+
+	if err := storage.SaveIfAbsent(&Link{Key: link.Key, LongUrl: "https://github.com/other"}); err != ErrKeyExists {
+		t.Errorf("Storage_SaveIfAbsent ERROR, expected ErrKeyExists, got %v", err)
+		return
+	}
+
+	// 生成的key与别名冲突时不能覆盖别名
+	if _, err := storage.SaveUnique(&Link{Key: link.Key, LongUrl: "https://github.com/other"}); err != ErrKeyExists {
+		t.Errorf("Storage_SaveUnique ERROR, expected ErrKeyExists, got %v", err)
+		return
+	}
+
+	linkFromStorage, err := storage.Get(link.Key)
+	if err != nil {
+		t.Errorf("Storage_Get ERROR: %s", err.Error())
+		return
+	}
+	if linkFromStorage.LongUrl != link.LongUrl {
+		t.Errorf("Storage_SaveIfAbsent ERROR, expected %s, got %s", link.LongUrl, linkFromStorage.LongUrl)
+		return
+	}
+
+	// 冲突后反向索引不应指向别名
+	other, err := storage.SaveUnique(&Link{Key: "other", LongUrl: "https://github.com/other"})
+	if err != nil {
+		t.Errorf("Storage_SaveUnique ERROR: %s", err.Error())
+		return
+	}
+	if other.Key != "other" {
+		t.Errorf("Storage_SaveUnique ERROR, expected other, got %s", other.Key)
+		return
+	}
+
+	storage.Delete(link.Key)
+	storage.Delete("other")
+}
+
+func TestRedisStorage_LegacyClicks(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	legacyStorage := NewRedisStorage(redisClient)
+	if err := legacyStorage.Save(&Link{Key: "clicks", LongUrl: "https://github.com/clicks"}); err != nil {
+		t.Fatalf("RedisStorage_Save ERROR: %s", err.Error())
+	}
+	legacyStorage.IncrClicks("clicks", 3)
+
+	// 开启分桶前的点击数仍然有效，迁移映射后也不丢失
+	storage := NewShardedRedisStorage(redisClient, 16)
+	storage.IncrClicks("clicks", 2)
+	if _, err := storage.MigrateToBuckets(10); err != nil {
+		t.Errorf("RedisStorage_MigrateToBuckets ERROR: %s", err.Error())
+		return
+	}
+	if clicks, err := storage.Clicks("clicks"); err != nil || clicks != 5 {
+		t.Errorf("RedisStorage_LegacyClicks ERROR, expected 5, got %d %v", clicks, err)
+		return
+	}
+
+	if err := storage.Delete("clicks"); err != nil {
+		t.Errorf("RedisStorage_Delete ERROR: %s", err.Error())
+		return
+	}
+	if n := redisClient.HLen(clicksKey).Val(); n != 0 {
+		t.Errorf("RedisStorage_LegacyClicks ERROR, expected empty legacy hash, got %d", n)
+		return
+	}
+
+	t.Logf("RedisStorage_LegacyClicks PASS")
+}
+
+func TestRedisStorage_SaveUniqueConcurrent(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+
+	nodeNumber := 8
+	keys := make([]string, nodeNumber)
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(nodeNumber)
+	for i := 0; i < nodeNumber; i++ {
+		go func(i int) {
+			defer waitGroup.Done()
+
+			storage := NewShardedRedisStorage(redisClient, 16)
+			link, err := storage.SaveUnique(&Link{
+				Key:     fmt.Sprintf("node%d", i),
+				LongUrl: "https://github.com/zhuyst/concurrent",
+			})
+			if err != nil {
+				t.Errorf("RedisStorage_SaveUniqueConcurrent ERROR: %s", err.Error())
+				return
+			}
+			keys[i] = link.Key
+		}(i)
+	}
+	waitGroup.Wait()
+
+	for _, key := range keys {
+		if key != keys[0] {
+			t.Errorf("RedisStorage_SaveUniqueConcurrent ERROR, expected one key, got %v", keys)
+			return
+		}
+	}
+
+	t.Logf("RedisStorage_SaveUniqueConcurrent PASS, key: %s", keys[0])
+}
+
+func TestRedisStorage_LegacyLongUrlIndex(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	longUrl := "https://github.com/zhuyst/legacy"
+	if _, err := NewRedisStorage(redisClient).SaveUnique(&Link{Key: "legacy", LongUrl: longUrl}); err != nil {
+		t.Fatalf("RedisStorage_SaveUnique ERROR: %s", err.Error())
+	}
+
+	// 开启分桶后仍复用旧Hash反向索引中的key
+	storage := NewShardedRedisStorage(redisClient, 16)
+	link, err := storage.SaveUnique(&Link{Key: "other", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("RedisStorage_LegacyLongUrlIndex ERROR: %s", err.Error())
+		return
+	}
+	if link.Key != "legacy" {
+		t.Errorf("RedisStorage_LegacyLongUrlIndex ERROR, expected legacy, got %s", link.Key)
+		return
+	}
+
+	// 删除后旧索引一起清理，再次生成得到新的key
+	if err := storage.Delete("legacy"); err != nil {
+		t.Errorf("RedisStorage_Delete ERROR: %s", err.Error())
+		return
+	}
+	link, err = storage.SaveUnique(&Link{Key: "other", LongUrl: longUrl})
+	if err != nil || link.Key != "other" {
+		t.Errorf("RedisStorage_LegacyLongUrlIndex ERROR, expected other, got %+v %v", link, err)
+		return
+	}
+
+	t.Logf("RedisStorage_LegacyLongUrlIndex PASS")
+}
+
+func TestRedisStorage_SaveUniqueRepair(t *testing.T) {
+	redisClient := helper.NewTestRedisClient()
+	storage := NewRedisStorage(redisClient)
+
+	// 模拟写入方在占位后崩溃
+	longUrl := "https://github.com/zhuyst/repair"
+	value, _ := json.Marshal(&Link{Key: "crashed", LongUrl: longUrl})
+	redisClient.HSet(longUrlKey, longUrlHash(longUrl), value)
+
+	link, err := storage.SaveUnique(&Link{Key: "other", LongUrl: longUrl})
+	if err != nil {
+		t.Errorf("RedisStorage_SaveUniqueRepair ERROR: %s", err.Error())
+		return
+	}
+	if link.Key != "crashed" {
+		t.Errorf("RedisStorage_SaveUniqueRepair ERROR, expected crashed, got %s", link.Key)
+		return
+	}
+
+	if _, err := storage.Get("crashed"); err != nil {
+		t.Errorf("RedisStorage_SaveUniqueRepair ERROR, expected crashed repaired, got %s", err.Error())
+		return
+	}
+
+	t.Logf("RedisStorage_SaveUniqueRepair PASS")
+}
+
+func testStorageSaveBatch(t *testing.T, storage builtinStorage) {
+	if err := storage.Save(&Link{Key: "taken", LongUrl: "https://github.com/taken"}); err != nil {
+		t.Errorf("Storage_Save ERROR: %s", err.Error())
+		return
+	}
+
+	expireAt := time.Now().Add(-time.Hour)
+	links := []*Link{
+		{Key: "batch1", LongUrl: "https://github.com/batch1"},
+		{Key: "taken", LongUrl: "https://github.com/other"},
+		{Key: "batch2", LongUrl: "https://github.com/batch2", ExpireAt: &expireAt},
+		{Key: "batch1", LongUrl: "https://github.com/other"},
+	}
+	errs := storage.(BatchSaver).SaveBatch(links)
+	expected := []error{nil, ErrKeyExists, nil, ErrKeyExists}
+	for i, err := range errs {
+		if err != expected[i] {
+			t.Errorf("Storage_SaveBatch ERROR, index %d, expected %v, got %v", i, expected[i], err)
+			return
+		}
+	}
+
+	for _, key := range []string{"batch1", "taken"} {
+		link, err := storage.Get(key)
+		if err != nil {
+			t.Errorf("Storage_Get ERROR: %s", err.Error())
+			return
+		}
+		if link.LongUrl != "https://github.com/"+key {
+			t.Errorf("Storage_SaveBatch ERROR, expected https://github.com/%s, got %s", key, link.LongUrl)
+			return
+		}
+	}
+
+	// 批量保存的过期时间同样生效
+	deleted, err := storage.DeleteExpired(time.Now())
+	if err != nil {
+		t.Errorf("Storage_DeleteExpired ERROR: %s", err.Error())
+		return
+	}
+	if deleted != 1 {
+		t.Errorf("Storage_SaveBatch ERROR, expected 1 expired, got %d", deleted)
+		return
+	}
+
+	storage.Delete("batch1")
+	storage.Delete("taken")
+}
+
+func testStorageScan(t *testing.T, storage builtinStorage) {
+	const linkNumber = 25
+	for i := 0; i < linkNumber; i++ {
+		key := fmt.Sprintf("scan%02d", i)
+		if err := storage.Save(&Link{Key: key, LongUrl: "https://github.com/" + key}); err != nil {
+			t.Errorf("Storage_Save ERROR: %s", err.Error())
+			return
+		}
+	}
+
+	keys := make(map[string]bool)
+	var cursor string
+	for page := 0; ; page++ {
+		if page > linkNumber {
+			t.Errorf("Storage_Scan ERROR, cursor not finished after %d pages", page)
+			return
+		}
+
+		links, nextCursor, err := storage.Scan(cursor, 10)
+		if err != nil {
+			t.Errorf("Storage_Scan ERROR: %s", err.Error())
+			return
+		}
+		for _, link := range links {
+			if strings.HasPrefix(link.Key, "scan") && link.LongUrl == "https://github.com/"+link.Key {
+				keys[link.Key] = true
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	if len(keys) != linkNumber {
+		t.Errorf("Storage_Scan ERROR, expected %d links, got %d", linkNumber, len(keys))
+		return
+	}
+
+	for key := range keys {
+		storage.Delete(key)
+	}
+}
+
+func testStorageClicks(t *testing.T, linkStorage Storage) {
+	storage := linkStorage.(interface {
+		Storage
+		ClickCounter
+	})
+
+	link := &Link{Key: "clicks", LongUrl: "https://github.com/zhuyst/clicks"}
+	if err := storage.Save(link); err != nil {
+		t.Errorf("Storage_Save ERROR: %s", err.Error())
+		return
+	}
+
+	if clicks, err := storage.Clicks(link.Key); err != nil || clicks != 0 {
+		t.Errorf("Storage_Clicks ERROR, expected 0, got %d %v", clicks, err)
+		return
+	}
+
+	for _, n := range []int64{1, 5} {
+		if err := storage.IncrClicks(link.Key, n); err != nil {
+			t.Errorf("Storage_IncrClicks ERROR: %s", err.Error())
+			return
+		}
+	}
+	if clicks, err := storage.Clicks(link.Key); err != nil || clicks != 6 {
+		t.Errorf("Storage_Clicks ERROR, expected 6, got %d %v", clicks, err)
+		return
+	}
+
+	// 删除后重新创建的同名链接从0开始计数，删除后才写入的点击数不计入
+	storage.Delete(link.Key)
+	if err := storage.IncrClicks(link.Key, 2); err != nil {
+		t.Errorf("Storage_IncrClicks ERROR: %s", err.Error())
+		return
+	}
+	if err := storage.Save(link); err != nil {
+		t.Errorf("Storage_Save ERROR: %s", err.Error())
+		return
+	}
+	if clicks, err := storage.Clicks(link.Key); err != nil || clicks != 0 {
+		t.Errorf("Storage_Clicks ERROR, expected 0 after delete, got %d %v", clicks, err)
+		return
+	}
+
+	storage.Delete(link.Key)
+}
+
+func testStorageUpdate(t *testing.T, storage Storage) {
+	updater, ok := storage.(Updater)
+	if !ok {
+		return
+	}
+
+	if err := updater.Update(&Link{Key: "update", LongUrl: "https://github.com/zhuyst"}); err != ErrNotFound {
+		t.Errorf("Storage_Update ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+	if exists, _ := storage.Exists("update"); exists {
+		t.Errorf("Storage_Update ERROR, expected missing key not created")
+		return
+	}
+
+	link := &Link{Key: "update", LongUrl: "https://github.com/zhuyst"}
+	if err := storage.SaveIfAbsent(link); err != nil {
+		t.Errorf("Storage_SaveIfAbsent ERROR: %s", err.Error())
+		return
+	}
+	link.LongUrl = "https://github.com/zhuyst/shorturl-service"
+	link.Disabled = true
+	if err := updater.Update(link); err != nil {
+		t.Errorf("Storage_Update ERROR: %s", err.Error())
+		return
+	}
+
+	updated, err := storage.Get("update")
+	if err != nil || updated.LongUrl != link.LongUrl || !updated.Disabled {
+		t.Errorf("Storage_Update ERROR, expected updated link, got %+v %v", updated, err)
+		return
+	}
+
+	// 删除后不能再被修改恢复
+	if err := storage.Delete("update"); err != nil {
+		t.Errorf("Storage_Delete ERROR: %s", err.Error())
+		return
+	}
+	if err := updater.Update(link); err != ErrNotFound {
+		t.Errorf("Storage_Update ERROR, expected ErrNotFound after delete, got %v", err)
+		return
+	}
+
+	t.Logf("Storage_Update PASS")
+}
@@ -0,0 +1,389 @@
+package url_storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/zhuyst/shorturl-service/logger"
+	"time"
+)
+
+const (
+	sqlMigrationTable = "shorturl_schema_migrations"
+
+	// 迁移时使用的pg_advisory_xact_lock锁id，避免多节点同时执行迁移
+	sqlMigrationLockId = 7266580
+)
+
+// sqlMigrations 只允许在末尾追加，版本号为下标+1
+var sqlMigrations = []string{
+	`CREATE TABLE shorturl_links (
+		id         BIGSERIAL    PRIMARY KEY,
+		key        VARCHAR(64)  NOT NULL,
+		long_url   TEXT         NOT NULL,
+		created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+		node_id    BIGINT       NOT NULL,
+		CONSTRAINT shorturl_links_key_unique UNIQUE (key)
+	)`,
+	`ALTER TABLE shorturl_links
+		ADD COLUMN creator     VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN client_ip   VARCHAR(64)  NOT NULL DEFAULT '',
+		ADD COLUMN user_agent  TEXT         NOT NULL DEFAULT '',
+		ADD COLUMN title       VARCHAR(255) NOT NULL DEFAULT '',
+		ADD COLUMN description TEXT         NOT NULL DEFAULT ''`,
+	`ALTER TABLE shorturl_links ADD COLUMN expire_at TIMESTAMPTZ NULL`,
+	`CREATE INDEX shorturl_links_expire_at_idx ON shorturl_links (expire_at) WHERE expire_at IS NOT NULL`,
+	`ALTER TABLE shorturl_links ADD COLUMN long_url_hash CHAR(40) NULL`,
+	`CREATE UNIQUE INDEX shorturl_links_long_url_hash_unique ON shorturl_links (long_url_hash)`,
+	`ALTER TABLE shorturl_links ADD COLUMN tags JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE shorturl_links ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE shorturl_links ADD COLUMN redirect_status SMALLINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE shorturl_links ADD COLUMN passthrough VARCHAR(16) NOT NULL DEFAULT ''`,
+	`ALTER TABLE shorturl_links ADD COLUMN clicks BIGINT NOT NULL DEFAULT 0`,
+}
+
+const sqlLinkColumns = `key, long_url, created_at, node_id,
+	creator, client_ip, user_agent, title, description, expire_at, tags, disabled,
+	redirect_status, passthrough`
+
+const sqlInsertIfAbsent = `INSERT INTO shorturl_links (` + sqlLinkColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	ON CONFLICT (key) DO NOTHING`
+
+// SqlStorage 基于database/sql的存储，SQL方言为PostgreSQL，驱动由调用方引入
+type SqlStorage struct {
+	db *sql.DB
+}
+
+// NewSqlStorage 创建存储并执行尚未应用的迁移
+func NewSqlStorage(db *sql.DB) (*SqlStorage, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	storage := &SqlStorage{
+		db: db,
+	}
+	if err := storage.migrate(); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+func (storage *SqlStorage) migrate() error {
+	if _, err := storage.db.Exec(`CREATE TABLE IF NOT EXISTS ` + sqlMigrationTable + ` (
+		version    INT         PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	for i, migration := range sqlMigrations {
+		if err := storage.applyMigration(i+1, migration); err != nil {
+			logger.Error("SqlStorage migrate FAIL, version: %d, Error: %s", i+1, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storage *SqlStorage) applyMigration(version int, migration string) error {
+	tx, err := storage.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, sqlMigrationLockId); err != nil {
+		return err
+	}
+
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+sqlMigrationTable+` WHERE version = $1)`,
+		version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO `+sqlMigrationTable+` (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logger.Info("SqlStorage migrate SUCCESS, version: %d", version)
+	return nil
+}
+
+func (storage *SqlStorage) Save(link *Link) error {
+	_, err := storage.db.Exec(`INSERT INTO shorturl_links (`+sqlLinkColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (key) DO UPDATE SET
+			long_url = EXCLUDED.long_url, created_at = EXCLUDED.created_at, node_id = EXCLUDED.node_id,
+			creator = EXCLUDED.creator, client_ip = EXCLUDED.client_ip, user_agent = EXCLUDED.user_agent,
+			title = EXCLUDED.title, description = EXCLUDED.description, expire_at = EXCLUDED.expire_at,
+			tags = EXCLUDED.tags, disabled = EXCLUDED.disabled,
+			redirect_status = EXCLUDED.redirect_status, passthrough = EXCLUDED.passthrough,
+			long_url_hash = CASE WHEN shorturl_links.long_url = EXCLUDED.long_url
+				THEN shorturl_links.long_url_hash ELSE NULL END`,
+		sqlLinkArgs(link)...)
+	return err
+}
+
+// Update 只更新已存在的行，长URL改变时清除long_url_hash，不再参与去重
+func (storage *SqlStorage) Update(link *Link) error {
+	res, err := storage.db.Exec(`UPDATE shorturl_links SET
+			long_url = $2, created_at = $3, node_id = $4,
+			creator = $5, client_ip = $6, user_agent = $7,
+			title = $8, description = $9, expire_at = $10,
+			tags = $11, disabled = $12,
+			redirect_status = $13, passthrough = $14,
+			long_url_hash = CASE WHEN long_url = $2 THEN long_url_hash ELSE NULL END
+		WHERE key = $1`,
+		sqlLinkArgs(link)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveUnique 依赖long_url_hash上的唯一索引保证并发时只有一个key生效
+func (storage *SqlStorage) SaveUnique(link *Link) (*Link, error) {
+	hash := longUrlHash(link.LongUrl)
+	res, err := storage.db.Exec(`INSERT INTO shorturl_links (`+sqlLinkColumns+`, long_url_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT DO NOTHING`,
+		append(sqlLinkArgs(link), hash)...)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 1 {
+		return link, nil
+	}
+
+	existing, err := scanLink(storage.db.QueryRow(`SELECT `+sqlLinkColumns+`
+		FROM shorturl_links WHERE long_url_hash = $1`, hash))
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyExists
+	}
+	return existing, err
+}
+
+func (storage *SqlStorage) SaveIfAbsent(link *Link) error {
+	res, err := storage.db.Exec(sqlInsertIfAbsent, sqlLinkArgs(link)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyExists
+	}
+	return nil
+}
+
+// SaveBatch 在同一个事务中写入，每行使用一个保存点，单行出错只回滚该行并返回对应的错误
+func (storage *SqlStorage) SaveBatch(links []*Link) []error {
+	errs := make([]error, len(links))
+
+	tx, err := storage.db.Begin()
+	if err != nil {
+		return fillErrors(errs, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(sqlInsertIfAbsent)
+	if err != nil {
+		return fillErrors(errs, err)
+	}
+	defer stmt.Close()
+
+	for i, link := range links {
+		if _, err := tx.Exec(`SAVEPOINT save_batch`); err != nil {
+			return fillErrors(errs, err)
+		}
+
+		errs[i] = insertIfAbsent(stmt, link)
+		if errs[i] != nil && errs[i] != ErrKeyExists {
+			// 出错后事务在回滚到保存点之前不能继续执行语句
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT save_batch`); err != nil {
+				return fillErrors(errs, err)
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(`RELEASE SAVEPOINT save_batch`); err != nil {
+			return fillErrors(errs, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fillErrors(errs, err)
+	}
+	return errs
+}
+
+// insertIfAbsent key已存在时返回ErrKeyExists
+func insertIfAbsent(stmt *sql.Stmt, link *Link) error {
+	res, err := stmt.Exec(sqlLinkArgs(link)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyExists
+	}
+	return nil
+}
+
+func (storage *SqlStorage) Get(key string) (*Link, error) {
+	link, err := scanLink(storage.db.QueryRow(`SELECT `+sqlLinkColumns+`
+		FROM shorturl_links WHERE key = $1`, key))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+func (storage *SqlStorage) IncrClicks(key string, n int64) error {
+	_, err := storage.db.Exec(`UPDATE shorturl_links SET clicks = clicks + $2 WHERE key = $1`, key, n)
+	return err
+}
+
+func (storage *SqlStorage) Clicks(key string) (int64, error) {
+	var clicks int64
+	err := storage.db.QueryRow(`SELECT clicks FROM shorturl_links WHERE key = $1`, key).Scan(&clicks)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return clicks, err
+}
+
+// Scan 按key做keyset分页，游标为上一页最后一个key
+func (storage *SqlStorage) Scan(cursor string, count int64) ([]*Link, string, error) {
+	rows, err := storage.db.Query(`SELECT `+sqlLinkColumns+`
+		FROM shorturl_links WHERE key > $1 ORDER BY key LIMIT $2`, cursor, count+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	links := make([]*Link, 0, count+1)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if int64(len(links)) > count {
+		links = links[:count]
+		nextCursor = links[count-1].Key
+	}
+	return links, nextCursor, nil
+}
+
+func sqlLinkArgs(link *Link) []interface{} {
+	createdAt := link.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	tags := []byte("[]")
+	if len(link.Tags) > 0 {
+		tags, _ = json.Marshal(link.Tags)
+	}
+
+	return []interface{}{link.Key, link.LongUrl, createdAt, link.NodeId,
+		link.Creator, link.ClientIp, link.UserAgent, link.Title, link.Description, link.ExpireAt, string(tags),
+		link.Disabled, link.RedirectStatus, link.Passthrough}
+}
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLink(row sqlScanner) (*Link, error) {
+	link := &Link{}
+	var tags []byte
+	if err := row.Scan(&link.Key, &link.LongUrl, &link.CreatedAt, &link.NodeId,
+		&link.Creator, &link.ClientIp, &link.UserAgent, &link.Title, &link.Description,
+		&link.ExpireAt, &tags, &link.Disabled,
+		&link.RedirectStatus, &link.Passthrough); err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 && string(tags) != "[]" {
+		if err := json.Unmarshal(tags, &link.Tags); err != nil {
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+func (storage *SqlStorage) Delete(key string) error {
+	res, err := storage.db.Exec(`DELETE FROM shorturl_links WHERE key = $1`, key)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (storage *SqlStorage) Exists(key string) (bool, error) {
+	var exists bool
+	err := storage.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM shorturl_links WHERE key = $1)`, key).
+		Scan(&exists)
+	return exists, err
+}
+
+func (storage *SqlStorage) DeleteExpired(before time.Time) (int64, error) {
+	res, err := storage.db.Exec(`DELETE FROM shorturl_links WHERE expire_at <= $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
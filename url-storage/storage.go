@@ -0,0 +1,225 @@
+package url_storage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound  = errors.New("url_storage: key not found")
+	ErrExpired   = errors.New("url_storage: link expired")
+	ErrKeyExists = errors.New("url_storage: key already exists")
+	ErrDisabled  = errors.New("url_storage: link disabled")
+
+	ErrInvalidCursor = errors.New("url_storage: invalid cursor")
+	ErrInvalidCount  = errors.New("url_storage: count must be positive")
+	ErrNotSupported  = errors.New("url_storage: not supported by storage")
+)
+
+type Link struct {
+	Key       string    `json:"key"`
+	LongUrl   string    `json:"long_url"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 生成该链接的节点
+	NodeId int64 `json:"node_id"`
+
+	// 创建者信息
+	Creator   string `json:"creator,omitempty"`
+	ClientIp  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
+
+	// 过期时间，为空时永不过期
+	ExpireAt *time.Time `json:"expire_at,omitempty"`
+
+	// 被禁用的链接不再跳转
+	Disabled bool `json:"disabled,omitempty"`
+
+	// 跳转使用的状态码，为0时使用服务的默认值
+	RedirectStatus int `json:"redirect_status,omitempty"`
+
+	// 跳转时合并请求中多余路径与查询参数的方式，为空时不合并
+	Passthrough string `json:"passthrough,omitempty"`
+}
+
+// 查询参数与长URL中已有参数冲突时的处理方式，同时表示开启透传
+const (
+	// 保留长URL中的参数
+	PassthroughKeepTarget = "keep_target"
+
+	// 使用请求中的参数覆盖
+	PassthroughOverride = "override"
+
+	// 两者都保留，长URL中的在前
+	PassthroughAppend = "append"
+)
+
+// 链接状态
+const (
+	StateActive   = "active"
+	StateExpired  = "expired"
+	StateDisabled = "disabled"
+)
+
+func (link *Link) Expired(now time.Time) bool {
+	return link.ExpireAt != nil && !now.Before(*link.ExpireAt)
+}
+
+// TargetUrl 跳转的目标URL，开启透传时把请求中多余的路径追加到长URL的路径后，
+// 并按Passthrough处理查询参数，未开启时直接返回长URL
+func (link *Link) TargetUrl(extraPath string, query url.Values) (string, error) {
+	if link.Passthrough == "" || (extraPath == "" && len(query) == 0) {
+		return link.LongUrl, nil
+	}
+
+	target, err := url.Parse(link.LongUrl)
+	if err != nil {
+		return "", err
+	}
+
+	if extraPath != "" && extraPath != "/" {
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(extraPath, "/")
+		target.RawPath = ""
+	}
+
+	if len(query) > 0 {
+		targetQuery := target.Query()
+		for name, values := range query {
+			_, conflict := targetQuery[name]
+			switch {
+			case !conflict || link.Passthrough == PassthroughOverride:
+				targetQuery[name] = values
+			case link.Passthrough == PassthroughAppend:
+				targetQuery[name] = append(targetQuery[name], values...)
+			}
+		}
+		target.RawQuery = targetQuery.Encode()
+	}
+	return target.String(), nil
+}
+
+// State 链接在now时的状态，禁用优先于过期
+func (link *Link) State(now time.Time) string {
+	switch {
+	case link.Disabled:
+		return StateDisabled
+	case link.Expired(now):
+		return StateExpired
+	default:
+		return StateActive
+	}
+}
+
+// Storage 短URL映射的存储后端，实现该接口即可替换默认的Redis存储
+type Storage interface {
+	// Save 保存key到长URL的映射
+	Save(link *Link) error
+
+	// SaveIfAbsent key已存在时返回ErrKeyExists且不覆盖
+	SaveIfAbsent(link *Link) error
+
+	// Get 根据key解析映射，不存在时返回ErrNotFound
+	Get(key string) (*Link, error)
+
+	// Delete 删除映射，不存在时返回ErrNotFound
+	Delete(key string) error
+
+	Exists(key string) (bool, error)
+}
+
+// ExpiredDeleter 可选接口，清理过期的映射。存储未实现时不启动后台清理，过期的链接只是无法访问，不会被删除
+type ExpiredDeleter interface {
+	// DeleteExpired 删除在before之前过期的映射，返回删除的数量
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// Scanner 可选接口，分页遍历映射。存储未实现时列出链接返回ErrNotSupported
+type Scanner interface {
+	// Scan 按游标分页遍历映射，cursor为空时从头开始，返回的游标为空时遍历结束，
+	// count只是每页数量的参考值，无法解析的游标返回ErrInvalidCursor
+	Scan(cursor string, count int64) ([]*Link, string, error)
+}
+
+// Deduplicator 可选接口，按长URL去重保存。存储未实现时不能开启去重
+type Deduplicator interface {
+	// SaveUnique 相同的长URL已经通过SaveUnique保存过时返回已有的映射且不保存，
+	// 多个节点并发保存同一个长URL时只会有一个key生效，key已被占用时返回ErrKeyExists
+	SaveUnique(link *Link) (*Link, error)
+}
+
+// Updater 可选接口，只修改已存在的映射。存储未实现时修改链接先检查是否存在再Save，
+// 与并发的删除之间存在竞争，可能恢复刚被删除的链接
+type Updater interface {
+	// Update 覆盖已存在的映射，key不存在时返回ErrNotFound且不创建
+	Update(link *Link) error
+}
+
+// BatchSaver 可选接口，一次写入多个映射。存储未实现时批量创建逐个调用SaveIfAbsent
+type BatchSaver interface {
+	// SaveBatch 按SaveIfAbsent的语义批量保存，返回与links一一对应的错误
+	SaveBatch(links []*Link) []error
+}
+
+// ClickCounter 可选接口，持久化点击数。存储未实现时点击数只保存在进程内存中，重启后清零
+type ClickCounter interface {
+	// IncrClicks 把key的点击数增加n，不存在的key可以不计数
+	IncrClicks(key string, n int64) error
+
+	// Clicks 查询key的点击数，没有点击时返回0
+	Clicks(key string) (int64, error)
+}
+
+// BatchClickCounter 可选接口，一次写入多个key的点击数。存储未实现时逐个调用IncrClicks
+type BatchClickCounter interface {
+	// IncrClicksBatch 按IncrClicks的语义批量增加点击数，出错时clicks中的点击数都视为未写入
+	IncrClicksBatch(clicks map[string]int64) error
+}
+
+func longUrlHash(longUrl string) string {
+	sum := sha1.Sum([]byte(longUrl))
+	return hex.EncodeToString(sum[:])
+}
+
+// fillErrors 把errs中尚未出错的位置填为err
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// scanLinks 基于map的存储按key排序分页，游标为上一页最后一个key
+func scanLinks(links map[string]Link, cursor string, count int64) ([]*Link, string) {
+	keys := make([]string, 0, len(links))
+	for key := range links {
+		if key > cursor {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var nextCursor string
+	if int64(len(keys)) > count {
+		keys = keys[:count]
+		nextCursor = keys[count-1]
+	}
+
+	page := make([]*Link, len(keys))
+	for i, key := range keys {
+		link := links[key]
+		page[i] = &link
+	}
+	return page, nextCursor
+}
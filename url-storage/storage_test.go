@@ -0,0 +1,35 @@
+package url_storage
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLink_TargetUrl(t *testing.T) {
+	query := url.Values{"tab": {"stars"}, "utm_source": {"qrcode"}}
+	testCases := []struct {
+		passthrough string
+		extraPath   string
+		expected    string
+	}{
+		{"", "/shorturl-service", "https://github.com/zhuyst?tab=repositories"},
+		{PassthroughKeepTarget, "/shorturl-service", "https://github.com/zhuyst/shorturl-service?tab=repositories&utm_source=qrcode"},
+		{PassthroughOverride, "", "https://github.com/zhuyst?tab=stars&utm_source=qrcode"},
+		{PassthroughAppend, "/", "https://github.com/zhuyst?tab=repositories&tab=stars&utm_source=qrcode"},
+	}
+
+	for _, testCase := range testCases {
+		link := &Link{LongUrl: "https://github.com/zhuyst?tab=repositories", Passthrough: testCase.passthrough}
+		targetUrl, err := link.TargetUrl(testCase.extraPath, query)
+		if err != nil {
+			t.Errorf("Link_TargetUrl ERROR: %s", err.Error())
+			return
+		}
+		if targetUrl != testCase.expected {
+			t.Errorf("Link_TargetUrl %s ERROR, expected %s, got %s", testCase.passthrough, testCase.expected, targetUrl)
+			return
+		}
+	}
+
+	t.Logf("Link_TargetUrl PASS")
+}
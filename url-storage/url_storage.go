@@ -1,22 +1,59 @@
 package url_storage
 
 import (
-	"fmt"
 	"github.com/go-redis/redis"
 	"github.com/zhuyst/shorturl-service/key-generator"
+	"net/url"
+	"strings"
+	"time"
 )
 
 const (
-	shortUrlKey = "SHORTURL_SERVICE:SHORT_URL"
+	generateTries = 3
+
+	// 过滤后数量不足时最多继续遍历的页数，避免一次请求遍历整个存储
+	listScanPages = 10
 )
 
+// LinkFilter 列出链接时的过滤条件，零值的条件不生效
+type LinkFilter struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// 长URL的主机名，不区分大小写
+	Host string
+}
+
+func (filter *LinkFilter) Match(link *Link) bool {
+	if filter == nil {
+		return true
+	}
+	if !filter.CreatedAfter.IsZero() && link.CreatedAt.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !link.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	if filter.Host != "" {
+		longUrl, err := url.Parse(link.LongUrl)
+		if err != nil || !strings.EqualFold(longUrl.Hostname(), filter.Host) {
+			return false
+		}
+	}
+	return true
+}
+
 type UrlStorage struct {
+	// 开启后相同的长URL复用已有的key，只对未设置过期时间的链接生效，存储需要实现Deduplicator
+	Deduplicate bool
+
 	shortUrlPrefix string
-	redisClient    *redis.Client
+	storage        Storage
 	keyGenerator   *key_generator.KeyGenerator
+	clicks         *clickCounter
 }
 
-func New(redisClient *redis.Client, shortUrlPrefix string) (*UrlStorage, error) {
+func New(redisClient redis.UniversalClient, shortUrlPrefix string) (*UrlStorage, error) {
 	if err := redisClient.Ping().Err(); err != nil {
 		return nil, err
 	}
@@ -26,22 +63,316 @@ func New(redisClient *redis.Client, shortUrlPrefix string) (*UrlStorage, error)
 		return nil, err
 	}
 
-	return &UrlStorage{
+	return NewWithStorage(NewRedisStorage(redisClient), keyGenerator, shortUrlPrefix), nil
+}
+
+func NewWithStorage(storage Storage, keyGenerator *key_generator.KeyGenerator,
+	shortUrlPrefix string) *UrlStorage {
+
+	urlStorage := &UrlStorage{
 		shortUrlPrefix: shortUrlPrefix,
-		redisClient:    redisClient,
+		storage:        storage,
 		keyGenerator:   keyGenerator,
-	}, nil
+		clicks:         newClickCounter(storage),
+	}
+	urlStorage.clicks.start()
+
+	return urlStorage
 }
 
 func (storage *UrlStorage) GenerateShortUrl(longUrl string) (string, error) {
-	key := storage.keyGenerator.Generate()
-	if err := storage.redisClient.HSet(shortUrlKey, key, longUrl).Err(); err != nil {
-		return "", err
+	return storage.CreateLink(&Link{
+		LongUrl: longUrl,
+	})
+}
+
+// CreateLink 为link生成key并保存，link中的元数据由调用方填写。
+// link.Key非空时作为自定义别名，已被占用时返回ErrKeyExists；去重命中时link会被替换为已有的链接
+func (storage *UrlStorage) CreateLink(link *Link) (string, error) {
+	link.CreatedAt = time.Now()
+	link.NodeId = storage.keyGenerator.NodeId
+
+	if link.Key != "" {
+		if err := storage.storage.SaveIfAbsent(link); err != nil {
+			return "", err
+		}
+		return storage.ShortUrl(link.Key), nil
+	}
+
+	// 生成的key可能恰好已被自定义别名占用，换一个key重试
+	for i := 0; i < generateTries; i++ {
+		link.Key = storage.keyGenerator.Generate()
+
+		err := storage.saveGenerated(link)
+		if err == ErrKeyExists {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return storage.ShortUrl(link.Key), nil
+	}
+
+	return "", ErrKeyExists
+}
+
+// CreateLinks 批量创建，返回与links一一对应的错误，单个链接失败不影响其他链接。
+// 需要去重的链接逐个保存，其余链接批量生成key后一次写入
+func (storage *UrlStorage) CreateLinks(links []*Link) []error {
+	errs := make([]error, len(links))
+	now := time.Now()
+
+	batch := make([]*Link, 0, len(links))
+	index := make([]int, 0, len(links))
+	generated := make([]bool, 0, len(links))
+	var generateCount int
+	for i, link := range links {
+		if link.Key == "" && storage.Deduplicate && link.ExpireAt == nil {
+			_, errs[i] = storage.CreateLink(link)
+			continue
+		}
+
+		link.CreatedAt = now
+		link.NodeId = storage.keyGenerator.NodeId
+		if link.Key == "" {
+			generateCount++
+		}
+
+		batch = append(batch, link)
+		index = append(index, i)
+		generated = append(generated, link.Key == "")
 	}
 
-	return fmt.Sprintf(storage.shortUrlPrefix + key), nil
+	keys := storage.keyGenerator.GenerateBatch(generateCount)
+	for j, link := range batch {
+		if generated[j] {
+			link.Key, keys = keys[0], keys[1:]
+		}
+	}
+
+	for j, err := range storage.saveBatch(batch) {
+		// 生成的key恰好已被自定义别名占用，单独重试
+		if err == ErrKeyExists && generated[j] {
+			batch[j].Key = ""
+			_, err = storage.CreateLink(batch[j])
+		}
+		errs[index[j]] = err
+	}
+	return errs
+}
+
+// saveBatch 存储实现BatchSaver时一次写入，否则逐个SaveIfAbsent
+func (storage *UrlStorage) saveBatch(links []*Link) []error {
+	if saver, ok := storage.storage.(BatchSaver); ok {
+		return saver.SaveBatch(links)
+	}
+
+	errs := make([]error, len(links))
+	for i, link := range links {
+		errs[i] = storage.storage.SaveIfAbsent(link)
+	}
+	return errs
 }
 
+func (storage *UrlStorage) saveGenerated(link *Link) error {
+	deduplicator, ok := storage.storage.(Deduplicator)
+	if !storage.Deduplicate || link.ExpireAt != nil || !ok {
+		return storage.storage.SaveIfAbsent(link)
+	}
+
+	existing, err := deduplicator.SaveUnique(link)
+	if err != nil {
+		return err
+	}
+
+	// 已有的链接被禁用时不复用，单独生成一个不参与去重的链接
+	if existing.Disabled {
+		return storage.storage.SaveIfAbsent(link)
+	}
+
+	*link = *existing
+	return nil
+}
+
+// GetLongUrlByKey 已过期的链接返回ErrExpired，被禁用的链接返回ErrDisabled
 func (storage *UrlStorage) GetLongUrlByKey(key string) (string, error) {
-	return storage.redisClient.HGet(shortUrlKey, key).Result()
+	link, err := storage.ResolveLink(key)
+	if err != nil {
+		return "", err
+	}
+	return link.LongUrl, nil
+}
+
+// ResolveLink 获取用于跳转的链接，错误与GetLongUrlByKey相同
+func (storage *UrlStorage) ResolveLink(key string) (*Link, error) {
+	link, err := storage.storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.Disabled {
+		return nil, ErrDisabled
+	}
+	if link.Expired(time.Now()) {
+		return nil, ErrExpired
+	}
+	return link, nil
+}
+
+func (storage *UrlStorage) GetLinkByKey(key string) (*Link, error) {
+	return storage.storage.Get(key)
+}
+
+// DeleteLink 删除链接及尚未写入存储的点击数，不存在时返回ErrNotFound
+func (storage *UrlStorage) DeleteLink(key string) error {
+	if err := storage.storage.Delete(key); err != nil {
+		return err
+	}
+
+	storage.clicks.drop(key)
+	return nil
+}
+
+// UpdateLongUrl 修改已有链接的长URL，key不存在时返回ErrNotFound而不会创建
+func (storage *UrlStorage) UpdateLongUrl(key string, longUrl string) (*Link, error) {
+	link, err := storage.storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if link.LongUrl == longUrl {
+		return link, nil
+	}
+
+	link.LongUrl = longUrl
+	if err := storage.update(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// update 存储实现Updater时只覆盖已存在的链接，否则先检查是否存在再Save
+func (storage *UrlStorage) update(link *Link) error {
+	if updater, ok := storage.storage.(Updater); ok {
+		return updater.Update(link)
+	}
+
+	exists, err := storage.storage.Exists(link.Key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return storage.storage.Save(link)
+}
+
+// DisableLink 禁用链接，禁用后跳转返回ErrDisabled，元数据仍可查询
+func (storage *UrlStorage) DisableLink(key string) (*Link, error) {
+	return storage.setDisabled(key, true)
+}
+
+func (storage *UrlStorage) EnableLink(key string) (*Link, error) {
+	return storage.setDisabled(key, false)
+}
+
+func (storage *UrlStorage) setDisabled(key string, disabled bool) (*Link, error) {
+	link, err := storage.storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if link.Disabled == disabled {
+		return link, nil
+	}
+
+	link.Disabled = disabled
+	if err := storage.update(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// ListLinks 按游标分页列出符合filter的链接，返回的游标为空时遍历结束。
+// 过滤在遍历后进行，每页数量可能少于count，但只要游标不为空就应继续翻页，count <= 0时返回ErrInvalidCount，
+// 存储未实现Scanner时返回ErrNotSupported
+func (storage *UrlStorage) ListLinks(cursor string, count int64, filter *LinkFilter) ([]*Link, string, error) {
+	if count <= 0 {
+		return nil, "", ErrInvalidCount
+	}
+
+	scanner, ok := storage.storage.(Scanner)
+	if !ok {
+		return nil, "", ErrNotSupported
+	}
+
+	links := make([]*Link, 0, count)
+	for i := 0; i < listScanPages; i++ {
+		page, nextCursor, err := scanner.Scan(cursor, count)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, link := range page {
+			if filter.Match(link) {
+				links = append(links, link)
+			}
+		}
+
+		cursor = nextCursor
+		if cursor == "" || int64(len(links)) >= count {
+			break
+		}
+	}
+	return links, cursor, nil
+}
+
+// RecordClick 记录一次点击，点击数在后台批量写入存储，不会阻塞跳转
+func (storage *UrlStorage) RecordClick(key string) {
+	storage.clicks.incr(key)
+}
+
+// Clicks 查询链接的总点击数，包括尚未写入存储的点击，链接不存在时返回ErrNotFound
+func (storage *UrlStorage) Clicks(key string) (int64, error) {
+	exists, err := storage.storage.Exists(key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrNotFound
+	}
+
+	clickStorage, ok := storage.storage.(ClickCounter)
+	if !ok {
+		return storage.clicks.get(key), nil
+	}
+
+	clicks, err := clickStorage.Clicks(key)
+	if err != nil {
+		return 0, err
+	}
+	return clicks + storage.clicks.get(key), nil
+}
+
+// FlushClicks 立即把累加的点击数写入存储
+func (storage *UrlStorage) FlushClicks() error {
+	return storage.clicks.flush()
+}
+
+// Close 停止后台定期写入点击数的任务，并写入尚未写入的点击数，不会关闭底层存储。
+// 之后的点击只在调用FlushClicks时写入
+func (storage *UrlStorage) Close() error {
+	return storage.clicks.close()
+}
+
+func (storage *UrlStorage) ShortUrl(key string) string {
+	return storage.shortUrlPrefix + key
+}
+
+// DeleteExpired 删除在before之前过期的链接，存储未实现ExpiredDeleter时返回ErrNotSupported
+func (storage *UrlStorage) DeleteExpired(before time.Time) (int64, error) {
+	deleter, ok := storage.storage.(ExpiredDeleter)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return deleter.DeleteExpired(before)
 }
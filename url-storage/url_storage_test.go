@@ -2,8 +2,10 @@ package url_storage
 
 import (
 	"github.com/zhuyst/shorturl-service/helper"
+	"github.com/zhuyst/shorturl-service/key-generator"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewUrlStorage(t *testing.T) {
@@ -79,3 +81,446 @@ func newUrlStorage() (*UrlStorage, error) {
 	redisClient := helper.NewTestRedisClient()
 	return New(redisClient, "https://d.zhuyst.cc/")
 }
+
+func TestUrlStorage_CreateLinkAlias(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+
+	shortUrl, err := urlStorage.CreateLink(&Link{Key: "launch2026", LongUrl: "https://github.com/zhuyst"})
+	if err != nil {
+		t.Errorf("UrlStorage_CreateLinkAlias ERROR: %s", err.Error())
+		return
+	}
+	if shortUrl != urlStorage.shortUrlPrefix+"launch2026" {
+		t.Errorf("UrlStorage_CreateLinkAlias ERROR, expected %slaunch2026, got %s",
+			urlStorage.shortUrlPrefix, shortUrl)
+		return
+	}
+
+	_, err = urlStorage.CreateLink(&Link{Key: "launch2026", LongUrl: "https://github.com/other"})
+	if err != ErrKeyExists {
+		t.Errorf("UrlStorage_CreateLinkAlias ERROR, expected ErrKeyExists, got %v", err)
+		return
+	}
+
+	longUrl, err := urlStorage.GetLongUrlByKey("launch2026")
+	if err != nil || longUrl != "https://github.com/zhuyst" {
+		t.Errorf("UrlStorage_CreateLinkAlias ERROR, expected alias not overwritten, got %s", longUrl)
+		return
+	}
+
+	t.Logf("UrlStorage_CreateLinkAlias PASS")
+}
+
+func TestUrlStorage_CreateLinks(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+	urlStorage.Deduplicate = true
+
+	if _, err := urlStorage.CreateLink(&Link{Key: "batch2026", LongUrl: "https://github.com/zhuyst"}); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	links := []*Link{
+		{LongUrl: "https://github.com/zhuyst/batch1"},
+		{Key: "batch2026", LongUrl: "https://github.com/zhuyst/batch2"},
+		{Key: "batch2027", LongUrl: "https://github.com/zhuyst/batch3"},
+		{LongUrl: "https://github.com/zhuyst/batch1"},
+	}
+	errs := urlStorage.CreateLinks(links)
+	expected := []error{nil, ErrKeyExists, nil, nil}
+	for i, err := range errs {
+		if err != expected[i] {
+			t.Errorf("UrlStorage_CreateLinks ERROR, index %d, expected %v, got %v", i, expected[i], err)
+			return
+		}
+	}
+
+	// 开启去重时批量中相同的长URL复用同一个key
+	if links[0].Key == "" || links[0].Key != links[3].Key {
+		t.Errorf("UrlStorage_CreateLinks ERROR, expected same key, got %s and %s", links[0].Key, links[3].Key)
+		return
+	}
+
+	longUrl, err := urlStorage.GetLongUrlByKey("batch2027")
+	if err != nil || longUrl != "https://github.com/zhuyst/batch3" {
+		t.Errorf("UrlStorage_CreateLinks ERROR, expected https://github.com/zhuyst/batch3, got %s", longUrl)
+		return
+	}
+
+	t.Logf("UrlStorage_CreateLinks PASS")
+}
+
+// minimalStorage 只实现Storage接口，不实现任何可选接口
+type minimalStorage struct {
+	Storage
+}
+
+func TestUrlStorage_CreateLinksWithoutBatchSaver(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+	storage := minimalStorage{NewMemoryStorage()}
+	urlStorage := NewWithStorage(storage, keyGenerator, "https://d.zhuyst.cc/")
+
+	storage.Save(&Link{Key: "batch2026", LongUrl: "https://github.com/zhuyst"})
+	links := []*Link{
+		{LongUrl: "https://github.com/zhuyst/batch1"},
+		{Key: "batch2026", LongUrl: "https://github.com/zhuyst/batch2"},
+		{Key: "batch2027", LongUrl: "https://github.com/zhuyst/batch3"},
+	}
+	errs := urlStorage.CreateLinks(links)
+	expected := []error{nil, ErrKeyExists, nil}
+	for i, err := range errs {
+		if err != expected[i] {
+			t.Errorf("UrlStorage_CreateLinksWithoutBatchSaver ERROR, index %d, expected %v, got %v",
+				i, expected[i], err)
+			return
+		}
+	}
+
+	longUrl, err := urlStorage.GetLongUrlByKey(links[0].Key)
+	if err != nil || longUrl != "https://github.com/zhuyst/batch1" {
+		t.Errorf("UrlStorage_CreateLinksWithoutBatchSaver ERROR, expected https://github.com/zhuyst/batch1, got %s %v",
+			longUrl, err)
+		return
+	}
+
+	t.Logf("UrlStorage_CreateLinksWithoutBatchSaver PASS")
+}
+
+func TestUrlStorage_DisableLink(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+	urlStorage.Deduplicate = true
+
+	link := &Link{LongUrl: "https://github.com/zhuyst/disable"}
+	if _, err := urlStorage.CreateLink(link); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	if _, err := urlStorage.DisableLink(link.Key); err != nil {
+		t.Errorf("UrlStorage_DisableLink ERROR: %s", err.Error())
+		return
+	}
+	if _, err := urlStorage.GetLongUrlByKey(link.Key); err != ErrDisabled {
+		t.Errorf("UrlStorage_DisableLink ERROR, expected ErrDisabled, got %v", err)
+		return
+	}
+
+	// 被禁用的链接不参与去重
+	other := &Link{LongUrl: link.LongUrl}
+	if _, err := urlStorage.CreateLink(other); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+	if other.Key == link.Key {
+		t.Errorf("UrlStorage_DisableLink ERROR, expected new key, got disabled key %s", other.Key)
+		return
+	}
+
+	if _, err := urlStorage.EnableLink(link.Key); err != nil {
+		t.Errorf("UrlStorage_EnableLink ERROR: %s", err.Error())
+		return
+	}
+	if _, err := urlStorage.GetLongUrlByKey(link.Key); err != nil {
+		t.Errorf("UrlStorage_EnableLink ERROR: %s", err.Error())
+		return
+	}
+
+	if err := urlStorage.DeleteLink(link.Key); err != nil {
+		t.Errorf("UrlStorage_DeleteLink ERROR: %s", err.Error())
+		return
+	}
+	if _, err := urlStorage.DisableLink(link.Key); err != ErrNotFound {
+		t.Errorf("UrlStorage_DisableLink ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+
+	t.Logf("UrlStorage_DisableLink PASS")
+}
+
+// deletingStorage 读取后立即删除，模拟读取与写回之间并发的删除
+type deletingStorage struct {
+	*MemoryStorage
+}
+
+func (storage *deletingStorage) Get(key string) (*Link, error) {
+	link, err := storage.MemoryStorage.Get(key)
+	if err == nil {
+		storage.MemoryStorage.Delete(key)
+	}
+	return link, err
+}
+
+func TestUrlStorage_ConcurrentDelete(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+	storage := &deletingStorage{NewMemoryStorage()}
+	urlStorage := NewWithStorage(storage, keyGenerator, "https://d.zhuyst.cc/")
+
+	for _, action := range []func(key string) (*Link, error){
+		urlStorage.DisableLink,
+		func(key string) (*Link, error) {
+			return urlStorage.UpdateLongUrl(key, "https://github.com/zhuyst/after")
+		},
+	} {
+		storage.Save(&Link{Key: "deleted", LongUrl: "https://github.com/zhuyst"})
+		if _, err := action("deleted"); err != ErrNotFound {
+			t.Errorf("UrlStorage_ConcurrentDelete ERROR, expected ErrNotFound, got %v", err)
+			return
+		}
+		if exists, _ := storage.Exists("deleted"); exists {
+			t.Errorf("UrlStorage_ConcurrentDelete ERROR, expected deleted link not restored")
+			return
+		}
+	}
+
+	t.Logf("UrlStorage_ConcurrentDelete PASS")
+}
+
+func TestUrlStorage_UpdateLongUrl(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+	urlStorage.Deduplicate = true
+
+	link := &Link{LongUrl: "https://github.com/zhuyst/before"}
+	if _, err := urlStorage.CreateLink(link); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	if _, err := urlStorage.UpdateLongUrl(link.Key, "https://github.com/zhuyst/after"); err != nil {
+		t.Errorf("UrlStorage_UpdateLongUrl ERROR: %s", err.Error())
+		return
+	}
+
+	longUrl, err := urlStorage.GetLongUrlByKey(link.Key)
+	if err != nil || longUrl != "https://github.com/zhuyst/after" {
+		t.Errorf("UrlStorage_UpdateLongUrl ERROR, expected https://github.com/zhuyst/after, got %s", longUrl)
+		return
+	}
+
+	// 修改后原来的长URL不再复用该key
+	other := &Link{LongUrl: "https://github.com/zhuyst/before"}
+	if _, err := urlStorage.CreateLink(other); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+	if other.Key == link.Key {
+		t.Errorf("UrlStorage_UpdateLongUrl ERROR, expected new key, got %s", other.Key)
+		return
+	}
+
+	if _, err := urlStorage.UpdateLongUrl("notexists", "https://github.com/zhuyst"); err != ErrNotFound {
+		t.Errorf("UrlStorage_UpdateLongUrl ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+	if exists, _ := urlStorage.storage.Exists("notexists"); exists {
+		t.Errorf("UrlStorage_UpdateLongUrl ERROR, expected notexists not created")
+		return
+	}
+
+	t.Logf("UrlStorage_UpdateLongUrl PASS")
+}
+
+func TestUrlStorage_Clicks(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+
+	link := &Link{LongUrl: "https://github.com/zhuyst/clicks"}
+	if _, err := urlStorage.CreateLink(link); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		urlStorage.RecordClick(link.Key)
+	}
+	if clicks, err := urlStorage.Clicks(link.Key); err != nil || clicks != 3 {
+		t.Errorf("UrlStorage_Clicks ERROR, expected 3, got %d %v", clicks, err)
+		return
+	}
+
+	if err := urlStorage.FlushClicks(); err != nil {
+		t.Errorf("UrlStorage_FlushClicks ERROR: %s", err.Error())
+		return
+	}
+	urlStorage.RecordClick(link.Key)
+	if clicks, err := urlStorage.Clicks(link.Key); err != nil || clicks != 4 {
+		t.Errorf("UrlStorage_Clicks ERROR, expected 4, got %d %v", clicks, err)
+		return
+	}
+
+	if _, err := urlStorage.Clicks("notexists"); err != ErrNotFound {
+		t.Errorf("UrlStorage_Clicks ERROR, expected ErrNotFound, got %v", err)
+		return
+	}
+
+	// 关闭时写入剩余的点击数
+	if err := urlStorage.Close(); err != nil {
+		t.Errorf("UrlStorage_Close ERROR: %s", err.Error())
+		return
+	}
+	if clicks, err := urlStorage.storage.(ClickCounter).Clicks(link.Key); err != nil || clicks != 4 {
+		t.Errorf("UrlStorage_Close ERROR, expected 4 stored clicks, got %d %v", clicks, err)
+		return
+	}
+	if err := urlStorage.Close(); err != nil {
+		t.Errorf("UrlStorage_Close twice ERROR: %s", err.Error())
+		return
+	}
+
+	t.Logf("UrlStorage_Clicks PASS")
+}
+
+func TestUrlStorage_ClicksAfterDelete(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+	defer urlStorage.Close()
+
+	link := &Link{Key: "deleted2026", LongUrl: "https://github.com/zhuyst/clicks"}
+	if _, err := urlStorage.CreateLink(link); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	// 删除前尚未写入的点击数被丢弃，重新占用的key从0开始计数
+	urlStorage.RecordClick(link.Key)
+	if err := urlStorage.DeleteLink(link.Key); err != nil {
+		t.Errorf("UrlStorage_DeleteLink ERROR: %s", err.Error())
+		return
+	}
+	if _, err := urlStorage.CreateLink(&Link{Key: link.Key, LongUrl: link.LongUrl}); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+	if err := urlStorage.FlushClicks(); err != nil {
+		t.Errorf("UrlStorage_FlushClicks ERROR: %s", err.Error())
+		return
+	}
+	if clicks, err := urlStorage.Clicks(link.Key); err != nil || clicks != 0 {
+		t.Errorf("UrlStorage_ClicksAfterDelete ERROR, expected 0, got %d %v", clicks, err)
+		return
+	}
+
+	urlStorage.DeleteLink(link.Key)
+	t.Logf("UrlStorage_ClicksAfterDelete PASS")
+}
+
+func TestUrlStorage_DeduplicateWithoutDeduplicator(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+	urlStorage := NewWithStorage(minimalStorage{NewMemoryStorage()}, keyGenerator, "https://d.zhuyst.cc/")
+	urlStorage.Deduplicate = true
+
+	// 存储不支持去重时每次生成新的key
+	first := &Link{LongUrl: "https://github.com/zhuyst/unique"}
+	second := &Link{LongUrl: first.LongUrl}
+	for _, link := range []*Link{first, second} {
+		if _, err := urlStorage.CreateLink(link); err != nil {
+			t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+			return
+		}
+	}
+	if first.Key == second.Key {
+		t.Errorf("UrlStorage_DeduplicateWithoutDeduplicator ERROR, expected different keys, got %s", first.Key)
+		return
+	}
+
+	t.Logf("UrlStorage_DeduplicateWithoutDeduplicator PASS")
+}
+
+func TestUrlStorage_NotSupported(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+	urlStorage := NewWithStorage(minimalStorage{NewMemoryStorage()}, keyGenerator, "https://d.zhuyst.cc/")
+
+	if _, _, err := urlStorage.ListLinks("", 10, &LinkFilter{}); err != ErrNotSupported {
+		t.Errorf("UrlStorage_ListLinks ERROR, expected ErrNotSupported, got %v", err)
+		return
+	}
+	if _, err := urlStorage.DeleteExpired(time.Now()); err != ErrNotSupported {
+		t.Errorf("UrlStorage_DeleteExpired ERROR, expected ErrNotSupported, got %v", err)
+		return
+	}
+
+	t.Logf("UrlStorage_NotSupported PASS")
+}
+
+func TestUrlStorage_ClicksWithoutClickCounter(t *testing.T) {
+	keyGenerator, err := key_generator.NewLocal(0)
+	if err != nil {
+		t.Errorf("KeyGenerator_NewLocal ERROR: %s", err.Error())
+		return
+	}
+	urlStorage := NewWithStorage(minimalStorage{NewMemoryStorage()}, keyGenerator, "https://d.zhuyst.cc/")
+
+	link := &Link{LongUrl: "https://github.com/zhuyst/clicks"}
+	if _, err := urlStorage.CreateLink(link); err != nil {
+		t.Errorf("UrlStorage_CreateLink ERROR: %s", err.Error())
+		return
+	}
+
+	// 存储不持久化点击数时保留在内存中
+	urlStorage.RecordClick(link.Key)
+	urlStorage.RecordClick(link.Key)
+	if err := urlStorage.Close(); err != nil {
+		t.Errorf("UrlStorage_Close ERROR: %s", err.Error())
+		return
+	}
+	if clicks, err := urlStorage.Clicks(link.Key); err != nil || clicks != 2 {
+		t.Errorf("UrlStorage_ClicksWithoutClickCounter ERROR, expected 2, got %d %v", clicks, err)
+		return
+	}
+
+	t.Logf("UrlStorage_ClicksWithoutClickCounter PASS")
+}
+
+func TestUrlStorage_ListLinksInvalidCount(t *testing.T) {
+	urlStorage, err := newUrlStorage()
+	if err != nil {
+		t.Errorf("NewUrlStorage ERROR: %s", err.Error())
+		return
+	}
+
+	for _, count := range []int64{0, -1} {
+		if _, _, err := urlStorage.ListLinks("", count, nil); err != ErrInvalidCount {
+			t.Errorf("UrlStorage_ListLinks ERROR, expected ErrInvalidCount for count %d, got %v", count, err)
+			return
+		}
+	}
+
+	t.Logf("UrlStorage_ListLinksInvalidCount PASS")
+}